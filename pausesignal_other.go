@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+// -pause-signal is not supported without SIGUSR1; main rejects it.
+const pauseSignalSupported = false
+
+// handlePauseSignal waits until stopCh is closed.
+func handlePauseSignal(msgCh chan<- string, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	<-stopCh
+	doneCh <- struct{}{}
+}
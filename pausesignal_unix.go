@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// -pause-signal is supported on unix systems, which have SIGUSR1.
+const pauseSignalSupported = true
+
+// handlePauseSignal toggles the pause state on each SIGUSR1 until
+// stopCh is closed, reporting each change via msgCh.
+func handlePauseSignal(msgCh chan<- string, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer func() { doneCh <- struct{}{} }()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+	for {
+		select {
+		case <-sigCh:
+			paused, at := loadPauser.toggle()
+			if paused {
+				msgCh <- fmt.Sprintf("Load paused at %v.\n", at.Format(time.RFC3339))
+			} else {
+				msgCh <- fmt.Sprintf("Load resumed at %v.\n", at.Format(time.RFC3339))
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// loadPayload reads the given file into memory.
+func loadPayload(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err == nil && len(data) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	return data, err
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// checkOpenFileLimit does nothing on systems without a limit of open
+// files set with setrlimit.
+func checkOpenFileLimit(need uint64) error {
+	return nil
+}
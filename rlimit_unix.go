@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// checkOpenFileLimit checks that the soft limit of open files is at
+// least need, and raises it up to the hard limit if not, so that a
+// too low limit fails the test before it starts instead of with
+// "too many open files" errors in the workers.
+func checkOpenFileLimit(need uint64) error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return fmt.Errorf("Unable to get the open file limit - %w", err)
+	}
+	if limit.Cur >= need {
+		return nil
+	}
+	if limit.Max < need {
+		return fmt.Errorf("the test needs about %v open files, but the limit is %v (hard limit %v) - raise it with ulimit -n, or lower -c",
+			need, limit.Cur, limit.Max)
+	}
+	oldLimit := limit.Cur
+	limit.Cur = need
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return fmt.Errorf("the test needs about %v open files, but the limit is %v and could not be raised - %w",
+			need, oldLimit, err)
+	}
+	fmt.Printf("Raised the open file limit from %v to %v.\n", oldLimit, need)
+	return nil
+}
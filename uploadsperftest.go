@@ -1,35 +1,166 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	crand "crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
 	"io"
+	"math"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/trace"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/parquet-go/parquet-go"
+	"github.com/segmentio/kafka-go"
+	_ "modernc.org/sqlite"
 )
 
 const (
 	// constant for default random seed.
 	defaultRandomSeed = 42
 
-	// minimum worker running time
-	workerDuration = time.Duration(time.Minute * 15)
+	// default minimum worker running time
+	defaultWorkerDuration = time.Duration(time.Minute * 15)
 
 	// minimum per worker upload count
 	minUploadCount = 10
 
 	// maximum number of distinct objects
 	maxDistinctObjects = 100000
+
+	// interval at which workers send their collected results to
+	// the collector.
+	statsFlushInterval = time.Second
+
+	// number of attempts to write an output file, and the delay
+	// before the first retry, which doubles on each retry.
+	outputWriteAttempts = 4
+	outputRetryDelay    = time.Second
+
+	// part size used for multipart uploads when only an abort rate
+	// is given.
+	defaultPartSize = 5 * 1024 * 1024
+
+	// timeout of the request to the -webhook-url.
+	webhookTimeout = 10 * time.Second
+)
+
+// benchmark modes
+const (
+	// upload objects
+	modePut = "put"
+
+	// list incomplete multipart uploads in the bucket
+	modeListIncomplete = "list-incomplete"
+
+	// upload objects one at a time with a pause in between, to
+	// measure latency without load
+	modeProbe = "probe"
+
+	// run a weighted mix of operations given by the workload
+	modeMixed = "mixed"
+
+	// retrieve the attributes of prepopulated objects with
+	// GetObjectAttributes
+	modeAttributes = "attributes"
+
+	// overwrite a fixed set of keys in a versioned bucket, to
+	// measure the write latency as the number of versions grows
+	modeVersions = "versions"
+
+	// download prepopulated objects via presigned URLs with a plain
+	// HTTP client
+	modePresignedGet = "presigned-get"
+
+	// upload and delete objects in a versioned bucket, to measure
+	// the latency of creating delete markers
+	modeDeleteMarkers = "delete-markers"
+
+	// restore objects in the bucket from a cold tier
+	modeRestore = "restore"
+
+	// upload objects and read them until they are visible, to
+	// measure the delay of read-after-write consistency
+	modeReadAfterWrite = "read-after-write"
+
+	// query prepopulated CSV or JSON objects with S3 Select
+	modeSelect = "select"
+
+	// upload empty or tiny objects with as little client work as
+	// possible, to measure the rate of metadata operations
+	modeTiny = "tiny"
+
+	// download prepopulated or existing objects with GetObject
+	modeGet = "get"
+
+	// delete prepopulated objects with DeleteObject
+	modeDelete = "delete"
+
+	// retrieve the metadata of prepopulated objects with HEAD
+	// requests
+	modeStat = "stat"
+)
+
+// operation types
+const (
+	opPut    = "put"
+	opGet    = "get"
+	opDelete = "delete"
+	opStat   = "stat"
+	opList   = "list"
+
+	opAttributes = "attributes"
+
+	// deletes in a versioned bucket, which create a delete marker
+	// or permanently delete a version.
+	opDeleteMarker  = "delete-marker"
+	opDeleteVersion = "delete-version"
+
+	// restore of an object from a cold tier, until it is readable.
+	opRestore = "restore"
+
+	// S3 Select query of an object.
+	opSelect = "select"
 )
 
 var (
@@ -65,41 +196,503 @@ var (
 	secretKey = os.Getenv("SECRET_KEY")
 
 	// settings from command line
+	mode           string
 	endpoint       string
 	secure         bool
+	endpoints      []s3Endpoint
+	splitSpec      string
 	bucket         string
 	concurrency    int
 	randomSeed     int64
 	maxDiskUsageGB int
 
+	// minimum worker running time
+	workerDuration time.Duration
+
+	// pause between requests in probe mode.
+	probeInterval time.Duration
+
+	// hard limit on the wall-clock time of the test, if not zero.
+	maxRuntime time.Duration
+
+	// time without any completed operation after which the stacks
+	// of all goroutines are dumped to a file, if not zero.
+	hangDumpAfter time.Duration
+
+	// time to wait before starting the workers, e.g. to start a
+	// packet capture.
+	delayStart time.Duration
+
+	// maximum random delay of each worker before its first
+	// operation, to spread out connection establishment.
+	startJitter time.Duration
+
+	// latency percentiles to report.
+	percentilesSpec    string
+	latencyPercentiles []float64
+
+	// operation mix of the mixed mode.
+	workloadSpec string
+	workload     workloadMix
+
+	// number of objects to upload before the test.
+	prepopulateCount int
+
+	// objects known to exist in the bucket, for operations on
+	// existing objects.
+	liveKeys = newKeySet()
+
+	// buckets to spread the workers and the prepopulated objects
+	// over, with -buckets, and the objects known to exist in each.
+	// The first bucket is bucket, and its objects are liveKeys.
+	bucketsSpec string
+	buckets     []string
+	bucketKeys  []*keySet
+
+	// multipart upload settings - a zero part size means objects
+	// are uploaded with a single PutObject call.
+	partSizeStr       string
+	partSize          int64
+	abortRate         float64
+	cleanupIncomplete bool
+
+	// fraction of uploads that overwrite an existing object instead
+	// of creating a new one.
+	overwriteRatio float64
+
+	// if set, the latencies of the steps of multipart uploads are
+	// recorded and reported separately.
+	manualMultipart bool
+
+	// algorithm of the checksum sent with each upload - empty for
+	// none.
+	checksumAlgorithm string
+
+	// if set, all objects in the bucket are removed before the
+	// test - after a confirmation, unless forced.
+	emptyBucket bool
+	force       bool
+
+	// size of the read and write buffers of the HTTP transport - a
+	// zero value uses the transport defaults.
+	bufferSizeStr string
+	bufferSize    int64
+
+	// whether Nagle's algorithm is disabled on the connections to
+	// the endpoints, as Go does by default.
+	tcpNoDelay bool
+
+	// HTTP client shared by all S3 clients.
+	httpClient *http.Client
+
+	// number of open files the test needs - a zero value estimates
+	// it from the concurrency.
+	maxOpenFiles uint64
+
+	// timeout of establishing a connection, and of a whole
+	// operation including its retries.
+	dialTimeout time.Duration
+	opTimeout   time.Duration
+
+	// maximum number of retries of a failed request by the SDK.
+	sdkRetries int
+
+	// if set, requests that fail to resolve the endpoint are retried
+	// until this long after they were created, even once the SDK
+	// retries are used up.
+	dnsRetryTimeout time.Duration
+
+	// backoff between retries - the initial delay, the maximum
+	// delay, and whether to randomize the delays. Zero delays use
+	// the SDK defaults.
+	retryBase   time.Duration
+	retryMax    time.Duration
+	retryJitter bool
+
+	// number of operations in a row that must fail for the test to
+	// be aborted.
+	maxConsecutiveErrors int
+
+	// whether to record the latencies of the failed operations
+	// tolerated by -max-consecutive-errors.
+	recordErrorLatency bool
+
+	// whether to count the new and reused connections.
+	connStats bool
+
+	// if set, the number of operations in flight is adapted to the
+	// rate of throttling responses, which must stay at most
+	// adaptiveThreshold.
+	adaptive          bool
+	adaptiveThreshold float64
+
+	// if positive, the maximum number of operations per second of
+	// all workers together. In mixed mode, rateOps, if set, limits
+	// it to the given operation types.
+	opRate      float64
+	rateOpsSpec string
+	rateOps     map[string]bool
+
+	// if set, short calibration runs at increasing concurrency
+	// levels pick the concurrency of the test, up to the one given
+	// by -c. Each level runs for autoConcurrencyStep, and doubling
+	// the concurrency must raise the ops/s by autoConcurrencyGain
+	// for the higher level to be chosen.
+	autoConcurrency     bool
+	autoConcurrencyStep time.Duration
+	autoConcurrencyGain float64
+
+	// unique id of this run - included in the JSON outputs, in the
+	// CSV outputs with -csv-comments, and in the User-Agent of all
+	// requests.
+	runID string
+
+	// if set, SIGUSR1 toggles pausing of the load.
+	pauseSignal bool
+
+	// if set, object sizes are read from stdin, one per upload.
+	sizesFromStdin bool
+
+	// if set, the object size is this many repetitions of the
+	// object's seed bytes.
+	sizeReps int64
+
+	// file to write a Go execution trace of the test to.
+	traceFile string
+
+	// maximum number of per-operation samples a worker sends to
+	// the collector in one message.
+	batchSize int
+
+	// number of goroutines the workers send their results to.
+	collectors int
+
+	// maximum number of per-operation samples kept - zero means
+	// no limit.
+	maxSamples int
+
+	// warn if workers finish over a longer span than this.
+	staggerWarn time.Duration
+
+	// if set, operations started after the first worker finished
+	// are excluded from latency statistics.
+	excludeRampdown bool
+
+	// if set, all workers are stopped together once the test
+	// duration has passed, instead of each worker stopping on its
+	// own.
+	syncStop bool
+
+	// number of successful operations after which each worker
+	// stops, instead of after the test duration - zero if not set.
+	iterationsPerWorker int
+
+	// files to write the results to - each output is only written
+	// if its file is given.
+	csvFile         string
+	parquetFile     string
+	sqliteFile      string
+	queueingFile    string
+	jsonSummaryFile string
+	rateFile        string
+	warpFile        string
+	cdfFile         string
+
+	// if set, the time each worker was active is recorded, and the
+	// number of active workers in each second is written to the
+	// rate file and plotted.
+	recordConcurrency bool
+
+	// if set, a background probe uploads a small object each
+	// second, apart from the workers, and records its latency.
+	healthcheck bool
+
+	// maximum number of points written to the CDF file - zero
+	// means one point per sample.
+	cdfPoints int
+
+	// whether to leave the first and the last second of the test
+	// out of the per-second operation counts.
+	completeSeconds bool
+
+	// format of the times in the CSV file.
+	timeFormat string
+
+	// directory to write a CSV file of each worker's operations to.
+	perWorkerDir string
+
+	// fraction of the operations written to the CSV file.
+	csvSampleRate float64
+
+	// whether to start the CSV files with comment lines with the
+	// run ID.
+	csvComments bool
+
+	// URL to post the JSON summary to at the end of the test.
+	webhookURL string
+
+	// address to stream operation results to WebSocket clients
+	// on.
+	wsAddr string
+
+	// Kafka brokers and topic to publish operation results to.
+	kafkaBrokersStr string
+	kafkaBrokers    []string
+	kafkaTopic      string
+
+	// address to serve the latency histogram to Prometheus on, and
+	// whether to serve it in the OpenMetrics format with exemplars
+	// carrying the trace id of an operation.
+	metricsAddr string
+	exemplars   bool
+
+	// static labels added to all metrics, as given by
+	// -metric-labels, and formatted as the start of a label set.
+	metricLabelsSpec string
+	metricLabels     string
+
+	// latency histogram served on metricsAddr - nil if disabled.
+	metrics *latencyMetrics
+
+	// file to read the run configuration from, and whether to
+	// print the effective configuration and exit.
+	configFile string
+	dumpConfig bool
+
+	// file to write a plot of the results to, and its format.
+	plotFile   string
+	plotFormat string
+
+	// format of the summary printed at the end of the test.
+	summaryFormat string
+
+	// file to write the manifest of uploaded objects to.
+	manifestFile string
+
+	// if set, uploaded objects are downloaded and checked against
+	// the manifest after the test.
+	audit bool
+
+	// file to write the result of each object's audit to.
+	auditReportFile string
+
+	// if set, the size of each uploaded object is checked against
+	// the manifest after the test.
+	checkSize bool
+
+	// fault injection settings, for testing this program.
+	faultInjectSpec string
+	faults          faultConfig
+
+	// pause state shared by all workers.
+	loadPauser = newPauser()
+
+	// time a worker waits between completing an operation and
+	// starting the next.
+	thinkTimeSpec string
+	thinkTime     durationRange
+
+	// key prefixes of the object size classes, and the size from
+	// which objects are large.
+	sizePrefixSpec   string
+	sizePrefixes     map[string]string
+	sizeThresholdStr string
+	sizeThreshold    int64
+
+	// number of keys, and of versions written to each key, in
+	// versions mode.
+	versionKeyCount int
+	versionCount    int
+
+	// keys of the versions mode, and the number of version
+	// uploads started so far, updated atomically.
+	versionKeys           []string
+	versionUploadsStarted int64
+
+	// if set, the object versions and delete markers created in
+	// delete-markers mode are then deleted permanently.
+	deleteVersions bool
+
+	// restore mode settings: the prefix of the objects to restore,
+	// the number of days to restore them for, how often to check
+	// whether a restore completed, and how long to wait for it.
+	restorePrefix  string
+	restoreDays    int64
+	restorePoll    time.Duration
+	restoreTimeout time.Duration
+
+	// read-after-write mode settings: the interval between reads of
+	// an uploaded object, and how long to wait for it to be visible.
+	visibilityPoll    time.Duration
+	visibilityTimeout time.Duration
+
+	// select mode settings: the format of the prepopulated objects,
+	// and the SQL expression to query them with.
+	selectFormat string
+	selectQuery  string
+
+	// number of object names to generate before the test, the
+	// names, and the number of them taken so far, updated
+	// atomically.
+	pregenNameCount int
+	pregenNames     []string
+	pregenNamesUsed int64
+
+	// if set, all reads are of this key.
+	targetKey string
+
+	// if set, all uploads write this key.
+	hotspotKey string
+
+	// template of the names of uploaded objects, if given instead
+	// of random names.
+	keyTemplateSpec string
+	objKeyTemplate  keyTemplate
+
+	// file of parent dirs to use instead of the built-in ones.
+	parentDirsFile string
+
+	// if set, random object names are picked so that the hex
+	// encoded keyHashAlgorithm hash of the name starts with
+	// keyHashPrefix, trying at most keyHashAttempts names each and
+	// keyHashBudget names in total.
+	keyHashPrefix    string
+	keyHashAlgorithm string
+	keyHashAttempts  int
+	keyHashBudget    int64
+
+	// number of names generated with a hash prefix, of those that
+	// matched it, and of the names tried for them - updated
+	// atomically.
+	keyHashNames   int64
+	keyHashMatched int64
+	keyHashTries   int64
+
+	// number of the generated names by the prefix of their hash of
+	// the length of keyHashPrefix, i.e. by the shard they land on.
+	keyHashShardsMu sync.Mutex
+	keyHashShards   = make(map[string]int64)
+
+	// if set, generated object names longer than this many bytes
+	// are truncated. keysNamed and keysTruncated count the object
+	// keys named from generated names and those truncated, once per
+	// key - updated atomically - and truncatedNames holds the
+	// generated names that were truncated.
+	maxKeyLength     int
+	keysNamed        int64
+	keysTruncated    int64
+	truncatedNamesMu sync.Mutex
+	truncatedNames   = make(map[string]bool)
+
+	// if set, the content of each object is unique throughout,
+	// instead of a repeated seed.
+	uniqueContent bool
+
+	// pattern of the content of the objects.
+	contentPattern string
+
+	// if above 0, the fraction of the content that is a run of one
+	// byte, with the rest unique.
+	compressibility float64
+
+	// if set, the time spent generating the content of each upload
+	// is measured.
+	measureGeneration bool
+
+	// file the content of objects is read from instead of being
+	// generated, and its content, mapped into memory.
+	payloadFile string
+	payload     []byte
+
 	// max number of distinct object names.
 	maxObjCount int
 
 	// random object names
 	randObjNames []string
+
+	// if set, the number of distinct names generated, instead of
+	// maxObjCount possibly repeated ones.
+	keyCardinality int
+
+	// flags of the names of randObjNames picked by operations,
+	// with -key-cardinality - set atomically.
+	keyUsed []int32
+
+	// range of the sizes of the uploaded objects, if given instead
+	// of a single size. Sizes are picked with the random source of
+	// each worker, so the same seed reproduces the same sizes.
+	objSizeRange sizeRange
 )
 
-func generateNames() {
+func generateNames() (err error) {
+	if keyCardinality > 0 {
+		fmt.Printf("Generating %v distinct names for objects...\n", keyCardinality)
+		if randObjNames, err = newUniqueNames(keyCardinality); err != nil {
+			return err
+		}
+		keyUsed = make([]int32, keyCardinality)
+		fmt.Println("done.")
+		return nil
+	}
 	fmt.Println("Generating names for objects...")
 	randObjNames = make([]string, 0, maxObjCount)
 	for i := 0; i < maxObjCount; i++ {
-		randObjNames = append(randObjNames, getRandomObjectName())
+		name, err := getRandomObjectName()
+		if err != nil {
+			return err
+		}
+		randObjNames = append(randObjNames, name)
 	}
 	fmt.Println("done.")
+	return nil
+}
+
+// pickObjectName returns one of the generated names, picked with r.
+func pickObjectName(r *rand.Rand) string {
+	i := r.Intn(len(randObjNames))
+	if keyUsed != nil {
+		atomic.StoreInt32(&keyUsed[i], 1)
+	}
+	return randObjNames[i]
+}
+
+// distinctKeysUsed returns the number of the names generated with
+// -key-cardinality that were picked by operations.
+func distinctKeysUsed() int {
+	used := 0
+	for i := range keyUsed {
+		if atomic.LoadInt32(&keyUsed[i]) != 0 {
+			used++
+		}
+	}
+	return used
+}
+
+// getKeyCardinalityMessage reports how many of the names generated
+// with -key-cardinality were used.
+func getKeyCardinalityMessage() string {
+	if keyCardinality == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Key cardinality: %v of %v distinct keys used.\n", distinctKeysUsed(), keyCardinality)
 }
 
 func setMaxObjects(size int64) {
 	maxDiskUsage := int64(maxDiskUsageGB) * 1000 * 1000 * 1000
 	maxObjCount = maxDistinctObjects
+	if size <= 0 {
+		// size is not known up front.
+		return
+	}
 	ratio := maxDiskUsage / size
 	if ratio < int64(maxObjCount) {
 		maxObjCount = int(ratio)
 	}
 }
 
-func getAlNumPerm() string {
+func getAlNumPerm(r *rand.Rand) string {
 	n := len(alNum)
-	p := rand.Perm(n)
+	p := r.Perm(n)
 	objNameRunes := make([]rune, n)
 	for i := 0; i < n; i++ {
 		objNameRunes[i] = alNum[p[i]]
@@ -107,7 +700,184 @@ func getAlNumPerm() string {
 	return string(objNameRunes)
 }
 
-func getRandomObjectName() string {
+// getRandomObjectName returns a random object name - with
+// -hash-prefix, one whose hash has the prefix if one is found.
+func getRandomObjectName() (string, error) {
+	if keyHashPrefix == "" {
+		raw := newRandomObjectName()
+		name, err := clampKey(raw)
+		if err == nil && name != raw {
+			markTruncated(name)
+		}
+		return name, err
+	}
+	atomic.AddInt64(&keyHashNames, 1)
+	// once the total budget is used up, names are used as they
+	// come, so that the rest of the names take no time.
+	attempts := int64(keyHashAttempts)
+	if left := keyHashBudget - atomic.LoadInt64(&keyHashTries); left < attempts {
+		attempts = left
+	}
+	var raw, name, hash string
+	for i := int64(1); ; i++ {
+		var err error
+		raw = newRandomObjectName()
+		if name, err = clampKey(raw); err != nil {
+			return "", err
+		}
+		hash = keyHash(name)
+		if strings.HasPrefix(hash, keyHashPrefix) {
+			atomic.AddInt64(&keyHashMatched, 1)
+		}
+		if strings.HasPrefix(hash, keyHashPrefix) || i >= attempts {
+			// give up on this name after the attempts, rather
+			// than stall.
+			atomic.AddInt64(&keyHashTries, i)
+			break
+		}
+	}
+	keyHashShardsMu.Lock()
+	keyHashShards[hash[:len(keyHashPrefix)]]++
+	keyHashShardsMu.Unlock()
+	if name != raw {
+		markTruncated(name)
+	}
+	return name, nil
+}
+
+// clampKey truncates a generated object name to maxKeyLength bytes,
+// without splitting a UTF-8 character or leaving a trailing slash,
+// which would name a directory. It fails if nothing of the name is
+// left, e.g. if the name starts with a slash.
+func clampKey(key string) (string, error) {
+	if maxKeyLength == 0 || len(key) <= maxKeyLength {
+		return key, nil
+	}
+	n := maxKeyLength
+	for n > 0 && !utf8.RuneStart(key[n]) {
+		n--
+	}
+	if clamped := strings.TrimRight(key[:n], "/"); clamped != "" {
+		return clamped, nil
+	}
+	return "", fmt.Errorf("object name %q is empty when truncated to the -max-key-length of %v bytes", key, maxKeyLength)
+}
+
+// markTruncated remembers a generated name that was truncated, so
+// that the keys named from it count as truncated.
+func markTruncated(name string) {
+	truncatedNamesMu.Lock()
+	truncatedNames[name] = true
+	truncatedNamesMu.Unlock()
+}
+
+// objectKey returns the key of an object named from the generated
+// name under the prefix, truncated with clampKey, and counts it for
+// getKeyLengthMessage.
+func objectKey(prefix, name string) (string, error) {
+	key, err := clampKey(prefix + name)
+	if err == nil {
+		countKey(key != prefix+name || nameTruncated(name))
+	}
+	return key, err
+}
+
+// countKey counts an object key named from a generated name, and
+// whether it was truncated.
+func countKey(truncated bool) {
+	atomic.AddInt64(&keysNamed, 1)
+	if truncated {
+		atomic.AddInt64(&keysTruncated, 1)
+	}
+}
+
+// nameTruncated returns whether the generated name was truncated.
+func nameTruncated(name string) bool {
+	if maxKeyLength == 0 {
+		return false
+	}
+	truncatedNamesMu.Lock()
+	defer truncatedNamesMu.Unlock()
+	return truncatedNames[name]
+}
+
+// getKeyLengthMessage warns about the share of the object keys
+// truncated to -max-key-length, as truncated names may collide.
+func getKeyLengthMessage() string {
+	truncated := atomic.LoadInt64(&keysTruncated)
+	if truncated == 0 {
+		return ""
+	}
+	named := atomic.LoadInt64(&keysNamed)
+	return fmt.Sprintf("Warning: %v of %v object names (%.1f%%) were truncated to the -max-key-length of %v bytes; truncated names may collide.\n",
+		truncated, named, 100*float64(truncated)/float64(named), maxKeyLength)
+}
+
+// key hash algorithms of -hash-algorithm
+const (
+	keyHashMD5    = "md5"
+	keyHashSHA256 = "sha256"
+	keyHashCRC32  = "crc32"
+)
+
+// keyHash returns the hex encoded keyHashAlgorithm hash of the key.
+func keyHash(key string) string {
+	switch keyHashAlgorithm {
+	case keyHashSHA256:
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	case keyHashCRC32:
+		return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(key)))
+	}
+	sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// getKeyHashMessage reports how many of the generated names have a
+// hash with the -hash-prefix.
+func getKeyHashMessage() string {
+	names := atomic.LoadInt64(&keyHashNames)
+	if keyHashPrefix == "" || names == 0 {
+		return ""
+	}
+	matched := atomic.LoadInt64(&keyHashMatched)
+	tries := atomic.LoadInt64(&keyHashTries)
+	msg := fmt.Sprintf("Hash prefix %v: %v of %v generated names (%.1f%%) have the prefix in their %v hash, after %.1f tries per name on average.\n",
+		keyHashPrefix, matched, names, 100*float64(matched)/float64(names), keyHashAlgorithm,
+		float64(tries)/float64(names))
+	if tries >= keyHashBudget {
+		msg += fmt.Sprintf("Warning: the -hash-budget of %v tries was used up, later names were not matched to the prefix.\n", keyHashBudget)
+	}
+	// the other prefixes of the same length, most used first.
+	keyHashShardsMu.Lock()
+	defer keyHashShardsMu.Unlock()
+	var others []string
+	for prefix := range keyHashShards {
+		if prefix != keyHashPrefix {
+			others = append(others, prefix)
+		}
+	}
+	if len(others) == 0 {
+		return msg
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if keyHashShards[others[i]] != keyHashShards[others[j]] {
+			return keyHashShards[others[i]] > keyHashShards[others[j]]
+		}
+		return others[i] < others[j]
+	})
+	msg += fmt.Sprintf("The other names are spread over %v other hash prefixes of %v hex digits:", len(others), len(keyHashPrefix))
+	for i, prefix := range others {
+		if i == 5 {
+			msg += " ..."
+			break
+		}
+		msg += fmt.Sprintf(" %v: %v", prefix, keyHashShards[prefix])
+	}
+	return msg + ".\n"
+}
+
+func newRandomObjectName() string {
 	dirString := parentDirs[rand.Intn(len(parentDirs))]
 	objPath := filepath.Join(strings.Fields(dirString)...)
 
@@ -117,6 +887,65 @@ func getRandomObjectName() string {
 	return filepath.Join(objPath, n)
 }
 
+// maxDistinctNames returns an upper bound of the number of distinct
+// random object names of at most -max-key-length bytes. A random name
+// is one of the parent dirs followed by a number below 10^9 written
+// three times, of which only the first digits may be left.
+func maxDistinctNames() int64 {
+	if maxKeyLength == 0 {
+		return math.MaxInt64
+	}
+	var total int64
+	for _, dir := range parentDirs {
+		objPath := filepath.Join(strings.Fields(dir)...)
+		digits := maxKeyLength - len(objPath)
+		if objPath != "" {
+			digits--
+		}
+		switch {
+		case digits <= 0:
+			// only the dir is left.
+			total++
+		case digits >= 9:
+			total += 1e9
+		default:
+			// the numbers of 1 to digits digits.
+			n := int64(10)
+			for i := 1; i < digits; i++ {
+				n = n*10 + 10
+			}
+			total += n
+		}
+	}
+	return total
+}
+
+// readParentDirs reads a list of parent dirs, one per line, from the
+// given file. Blank lines are skipped. If the file has no dirs, the
+// list holds only the empty dir, so that objects are named without
+// parent dirs.
+func readParentDirs(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			dirs = append(dirs, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		dirs = []string{""}
+	}
+	return dirs, nil
+}
+
 // object generator type - generates object content without IO.
 type ObjGen struct {
 	// name of object
@@ -128,56 +957,363 @@ type ObjGen struct {
 	// seed string that repeats inside the object
 	SeedBytes []byte
 
+	// with unique content, the content is the AES-CTR keystream
+	// of this cipher, keyed by the seed, instead of the repeated
+	// seed - so no part of it repeats within or across objects.
+	// With compressibility, part of each chunk of the keystream is
+	// replaced by a run of one byte.
+	contentCipher cipher.Block
+
+	// with -payload-file, the offset in the payload the content
+	// starts at, picked from the seed.
+	payloadOffset int64
+
 	// index to read at in the whole logical object
 	readIndex int64
+
+	// time spent generating content in nanoseconds, with
+	// -measure-generation - updated atomically, as the parts of a
+	// multipart upload are read concurrently.
+	genNanos int64
 }
 
-func NewRandomObjectWithSize(size int64) ObjGen {
-	return ObjGen{
-		ObjectName: randObjNames[rand.Intn(len(randObjNames))],
-		ObjectSize: size,
-		SeedBytes:  []byte(getAlNumPerm()),
+// NewRandomObjectWithSize returns an object of the given size, with
+// its name and content seed picked with r.
+func NewRandomObjectWithSize(r *rand.Rand, size int64) (ObjGen, error) {
+	seedBytes := []byte(getAlNumPerm(r))
+	return newNamedObject(seedBytes, size, pickObjectName(r))
+}
+
+// newNamedObject returns an object of the given size and content
+// seed, named from one of the generated names.
+func newNamedObject(seedBytes []byte, size int64, name string) (ObjGen, error) {
+	object := newKeyedObject(seedBytes, size, "")
+	key, err := objectKey(sizePrefix(object.ObjectSize), name)
+	if err != nil {
+		return ObjGen{}, err
 	}
+	object.ObjectName = key
+	return object, nil
 }
 
-// implement Reader interface
-func (og *ObjGen) Read(p []byte) (n int, err error) {
-	for n < len(p) && og.readIndex < og.ObjectSize {
-		bufIxStart := og.readIndex % int64(len(og.SeedBytes))
-		bytesLeftInObject := og.ObjectSize - og.readIndex
-		bytesLeftInSeedBytes := int64(len(og.SeedBytes)) - bufIxStart
-		var wroteCount int
-		if bytesLeftInObject < bytesLeftInSeedBytes {
-			wroteCount = copy(p[n:],
-				og.SeedBytes[bufIxStart:bufIxStart+bytesLeftInObject])
-		} else {
-			wroteCount = copy(p[n:],
-				og.SeedBytes[bufIxStart:])
+// newKeyedObject returns an object of the given size and content
+// seed with the given key, as is.
+func newKeyedObject(seedBytes []byte, size int64, key string) ObjGen {
+	if sizeReps > 0 {
+		// the content ends on a whole repetition of the seed.
+		size = sizeReps * int64(len(seedBytes))
+	}
+	return newObjGen(key, size, seedBytes)
+}
+
+// pregenerateNames generates the names of all count objects of the
+// test, so that no name is generated while the test runs. With a key
+// template, {worker} is the index of the name modulo the concurrency.
+func pregenerateNames(count int) (err error) {
+	fmt.Printf("Generating %v unique names for objects...\n", count)
+	start := time.Now()
+	if objKeyTemplate != nil {
+		r := rand.New(rand.NewSource(randomSeed))
+		pregenNames = make([]string, count)
+		for i := range pregenNames {
+			pregenNames[i] = objKeyTemplate.expand(strconv.Itoa(i%concurrency), r)
 		}
-		n += wroteCount
-		og.readIndex += int64(wroteCount)
+	} else if pregenNames, err = newUniqueNames(count); err != nil {
+		return err
 	}
-	if og.readIndex >= og.ObjectSize {
-		err = io.EOF
+	fmt.Printf("done in %v.\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// keyTemplate is a template of object names, as a sequence of
+// literal text and placeholders.
+type keyTemplate []keyTemplatePart
+
+// keyTemplatePart is literal text, or a placeholder if placeholder
+// is set.
+type keyTemplatePart struct {
+	text        string
+	placeholder bool
+}
+
+// placeholders of key templates: the current UTC date as
+// YYYY-MM-DD, the id of the worker, the sequence number of the
+// object in the run, and a random string of 8 letters and digits.
+var keyPlaceholders = map[string]bool{"date": true, "worker": true, "seq": true, "rand": true}
+
+// number of objects named from the key template so far.
+var keySeq int64
+
+// parseKeyTemplate parses a template of object names with
+// placeholders in braces, e.g. "{date}/{worker}/{seq}-{rand}".
+func parseKeyTemplate(spec string) (keyTemplate, error) {
+	var kt keyTemplate
+	for rest := spec; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			kt = append(kt, keyTemplatePart{text: rest})
+			break
+		}
+		if open > 0 {
+			kt = append(kt, keyTemplatePart{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in %q", spec)
+		}
+		name := rest[open+1 : open+end]
+		if !keyPlaceholders[name] {
+			return nil, fmt.Errorf("unknown placeholder {%v}", name)
+		}
+		kt = append(kt, keyTemplatePart{text: name, placeholder: true})
+		rest = rest[open+end+1:]
 	}
-	return
+	return kt, nil
 }
 
-func (og *ObjGen) Seek(off int64, whence int) (int64, error) {
-	var nval int64
-	switch whence {
-	case io.SeekStart:
-		nval = off
-	case io.SeekCurrent:
-		nval = og.readIndex + off
-	case io.SeekEnd:
-		nval = og.ObjectSize - off
+// expand returns an object name from the template, with random
+// strings picked with r.
+func (kt keyTemplate) expand(worker string, r *rand.Rand) string {
+	var b strings.Builder
+	for _, part := range kt {
+		if !part.placeholder {
+			b.WriteString(part.text)
+			continue
+		}
+		switch part.text {
+		case "date":
+			b.WriteString(time.Now().UTC().Format("2006-01-02"))
+		case "worker":
+			b.WriteString(worker)
+		case "seq":
+			b.WriteString(strconv.FormatInt(atomic.AddInt64(&keySeq, 1)-1, 10))
+		case "rand":
+			for i := 0; i < 8; i++ {
+				b.WriteRune(alNum[r.Intn(len(alNum))])
+			}
+		}
 	}
-	if nval < 0 || nval >= og.ObjectSize {
-		return 0, errors.New("invalid seek offset")
+	return b.String()
+}
+
+// hasPlaceholder returns whether the template has the placeholder of
+// the given name.
+func (kt keyTemplate) hasPlaceholder(name string) bool {
+	for _, part := range kt {
+		if part.placeholder && part.text == name {
+			return true
+		}
 	}
-	og.readIndex = nval
-	return og.readIndex, nil
+	return false
+}
+
+// number of random names newUniqueNames tries for each name it
+// returns.
+const uniqueNameAttempts = 10
+
+// newUniqueNames returns count distinct random object names. It fails
+// if it does not find them in uniqueNameAttempts tries per name, e.g.
+// if -max-key-length leaves fewer distinct names.
+func newUniqueNames(count int) ([]string, error) {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, count)
+	for tries := 0; len(keys) < count; tries++ {
+		if tries == uniqueNameAttempts*count {
+			return nil, fmt.Errorf("only %v distinct object names found in %v tries, %v needed", len(keys), tries, count)
+		}
+		key, err := getRandomObjectName()
+		if err != nil {
+			return nil, err
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// names returned by newUnusedName, guarded by usedNamesMu.
+var (
+	usedNamesMu sync.Mutex
+	usedNames   = make(map[string]bool)
+)
+
+// newUnusedName returns a random object name under the given prefix
+// that it never returned before, in read-after-write mode, so that
+// each upload creates a new object and no earlier version of it can
+// be read. Like newUniqueNames, it gives up after uniqueNameAttempts
+// tries.
+func newUnusedName(prefix string) (string, error) {
+	usedNamesMu.Lock()
+	defer usedNamesMu.Unlock()
+	for tries := 0; tries < uniqueNameAttempts; tries++ {
+		name, err := getRandomObjectName()
+		if err != nil {
+			return "", err
+		}
+		key, err := clampKey(prefix + name)
+		if err != nil {
+			return "", err
+		}
+		if !usedNames[key] {
+			usedNames[key] = true
+			countKey(key != prefix+name || nameTruncated(name))
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("no unused object name found in %v tries, after %v names", uniqueNameAttempts, len(usedNames))
+}
+
+// size classes of objects, for -size-prefix
+const (
+	sizeClassSmall = "small"
+	sizeClassLarge = "large"
+)
+
+// parseSizePrefixes parses a mapping of size classes to key
+// prefixes, e.g. "small=hot/,large=cold/".
+func parseSizePrefixes(spec string) (map[string]string, error) {
+	prefixes := make(map[string]string)
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid size prefix %q", kv)
+		}
+		class := strings.TrimSpace(parts[0])
+		if class != sizeClassSmall && class != sizeClassLarge {
+			return nil, fmt.Errorf("unknown size class %q", class)
+		}
+		prefixes[class] = strings.TrimSpace(parts[1])
+	}
+	return prefixes, nil
+}
+
+// sizePrefix returns the key prefix of objects of the given size:
+// objects smaller than sizeThreshold are small.
+func sizePrefix(size int64) string {
+	if size < sizeThreshold {
+		return sizePrefixes[sizeClassSmall]
+	}
+	return sizePrefixes[sizeClassLarge]
+}
+
+// prefixStats records the number and sizes of the objects uploaded
+// under a key prefix.
+type prefixStats struct {
+	Count   int64 `json:"count"`
+	Bytes   int64 `json:"bytes"`
+	MinSize int64 `json:"minSize"`
+	MaxSize int64 `json:"maxSize"`
+}
+
+func (ps *prefixStats) add(size int64) {
+	ps.merge(prefixStats{Count: 1, Bytes: size, MinSize: size, MaxSize: size})
+}
+
+func (ps *prefixStats) merge(other prefixStats) {
+	if ps.Count == 0 || other.MinSize < ps.MinSize {
+		ps.MinSize = other.MinSize
+	}
+	if other.MaxSize > ps.MaxSize {
+		ps.MaxSize = other.MaxSize
+	}
+	ps.Count += other.Count
+	ps.Bytes += other.Bytes
+}
+
+// content patterns
+const (
+	// the object's seed, repeated
+	patternRepeating = "repeating"
+
+	// unique content, as with -unique-content
+	patternRandom = "random"
+
+	// all bytes zero
+	patternZeros = "zeros"
+
+	// all bits set
+	patternOnes = "ones"
+
+	// the bytes 0 to 255 in turn, from the start of the object
+	patternSequential = "sequential"
+)
+
+// largest object size in tiny mode.
+const tinyMaxSize = 1024
+
+// content of the objects in tiny mode, which are slices of it.
+var tinyContent = bytes.Repeat([]byte{'x'}, tinyMaxSize)
+
+// size of the chunks that content with a compressibility is made
+// of.
+const compressChunkSize = 1024
+
+func newObjGen(name string, size int64, seedBytes []byte) ObjGen {
+	og := ObjGen{
+		ObjectName: name,
+		ObjectSize: size,
+		SeedBytes:  seedBytes,
+	}
+	if uniqueContent || compressibility > 0 {
+		// the first 16 bytes of the seed permutation make an
+		// AES-128 key - this cannot fail.
+		og.contentCipher, _ = aes.NewCipher(seedBytes[:16])
+	}
+	if payload != nil {
+		og.payloadOffset = int64(binary.BigEndian.Uint64(seedBytes[:8]) % uint64(len(payload)))
+	}
+	return og
+}
+
+// implement Reader interface
+func (og *ObjGen) Read(p []byte) (n int, err error) {
+	if og.contentCipher != nil || payload != nil || contentPattern != patternRepeating {
+		// ReadAt measures the generation time.
+		n, err = og.ReadAt(p, og.readIndex)
+		og.readIndex += int64(n)
+		return n, err
+	}
+	if measureGeneration {
+		defer og.addGenTime(time.Now())
+	}
+	for n < len(p) && og.readIndex < og.ObjectSize {
+		bufIxStart := og.readIndex % int64(len(og.SeedBytes))
+		bytesLeftInObject := og.ObjectSize - og.readIndex
+		bytesLeftInSeedBytes := int64(len(og.SeedBytes)) - bufIxStart
+		var wroteCount int
+		if bytesLeftInObject < bytesLeftInSeedBytes {
+			wroteCount = copy(p[n:],
+				og.SeedBytes[bufIxStart:bufIxStart+bytesLeftInObject])
+		} else {
+			wroteCount = copy(p[n:],
+				og.SeedBytes[bufIxStart:])
+		}
+		n += wroteCount
+		og.readIndex += int64(wroteCount)
+	}
+	if og.readIndex >= og.ObjectSize {
+		err = io.EOF
+	}
+	return
+}
+
+func (og *ObjGen) Seek(off int64, whence int) (int64, error) {
+	var nval int64
+	switch whence {
+	case io.SeekStart:
+		nval = off
+	case io.SeekCurrent:
+		nval = og.readIndex + off
+	case io.SeekEnd:
+		nval = og.ObjectSize - off
+	}
+	if nval < 0 || nval >= og.ObjectSize {
+		return 0, errors.New("invalid seek offset")
+	}
+	og.readIndex = nval
+	return og.readIndex, nil
 }
 
 // returns length of object
@@ -185,6 +1321,146 @@ func (og *ObjGen) Size() int64 {
 	return og.ObjectSize
 }
 
+// implement ReaderAt interface - does not change the read index, so
+// that parts of the object may be read independently.
+func (og *ObjGen) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("invalid read offset")
+	}
+	if measureGeneration {
+		defer og.addGenTime(time.Now())
+	}
+	if og.contentCipher != nil {
+		return og.readKeystreamAt(p, off)
+	}
+	if payload != nil {
+		return og.readPayloadAt(p, off)
+	}
+	if contentPattern != patternRepeating {
+		return og.readPatternAt(p, off)
+	}
+	seedLen := int64(len(og.SeedBytes))
+	for n < len(p) && off < og.ObjectSize {
+		bufIxStart := off % seedLen
+		end := seedLen
+		if og.ObjectSize-off < seedLen-bufIxStart {
+			end = bufIxStart + og.ObjectSize - off
+		}
+		wroteCount := copy(p[n:], og.SeedBytes[bufIxStart:end])
+		n += wroteCount
+		off += int64(wroteCount)
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// addGenTime adds the time since start to the generation time.
+func (og *ObjGen) addGenTime(start time.Time) {
+	atomic.AddInt64(&og.genNanos, int64(time.Since(start)))
+}
+
+// genDuration returns the time spent generating content so far.
+func (og *ObjGen) genDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&og.genNanos))
+}
+
+// readPatternAt reads the content at off, which is made of the bytes
+// of the zeros, ones or sequential -content-pattern.
+func (og *ObjGen) readPatternAt(p []byte, off int64) (n int, err error) {
+	if off >= og.ObjectSize {
+		return 0, io.EOF
+	}
+	n = len(p)
+	if int64(n) > og.ObjectSize-off {
+		n = int(og.ObjectSize - off)
+		err = io.EOF
+	}
+	buf := p[:n]
+	switch contentPattern {
+	case patternZeros:
+		for i := range buf {
+			buf[i] = 0
+		}
+	case patternOnes:
+		for i := range buf {
+			buf[i] = 0xff
+		}
+	case patternSequential:
+		for i := range buf {
+			buf[i] = byte(off + int64(i))
+		}
+	}
+	return n, err
+}
+
+// readPayloadAt reads the content at off, which is the payload
+// starting at the object's payload offset, wrapping around at its
+// end.
+func (og *ObjGen) readPayloadAt(p []byte, off int64) (n int, err error) {
+	payloadLen := int64(len(payload))
+	for n < len(p) && off < og.ObjectSize {
+		start := (og.payloadOffset + off) % payloadLen
+		end := payloadLen
+		if og.ObjectSize-off < end-start {
+			end = start + og.ObjectSize - off
+		}
+		wroteCount := copy(p[n:], payload[start:end])
+		n += wroteCount
+		off += int64(wroteCount)
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// readKeystreamAt reads the unique content at off, which is the
+// content cipher's CTR keystream starting at counter 0.
+func (og *ObjGen) readKeystreamAt(p []byte, off int64) (n int, err error) {
+	if off >= og.ObjectSize {
+		return 0, io.EOF
+	}
+	n = len(p)
+	if int64(n) > og.ObjectSize-off {
+		n = int(og.ObjectSize - off)
+		err = io.EOF
+	}
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(off/aes.BlockSize))
+	stream := cipher.NewCTR(og.contentCipher, iv)
+	// skip to the offset within the first block.
+	skip := make([]byte, off%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	buf := p[:n]
+	for i := range buf {
+		buf[i] = 0
+	}
+	stream.XORKeyStream(buf, buf)
+
+	if compressibility > 0 {
+		// replace the end of each chunk with a run of one
+		// byte, which compresses to almost nothing.
+		randomLen := int64(math.Round((1 - compressibility) * compressChunkSize))
+		for i := int64(0); i < int64(n); {
+			pos := (off + i) % compressChunkSize
+			if pos < randomLen {
+				i += randomLen - pos
+				continue
+			}
+			end := i + compressChunkSize - pos
+			if end > int64(n) {
+				end = int64(n)
+			}
+			for ; i < end; i++ {
+				buf[i] = og.SeedBytes[0]
+			}
+		}
+	}
+	return n, err
+}
+
 // Returns number of bytes expressed by human friendly
 // string. Supports:
 //
@@ -226,263 +1502,8246 @@ func parseHumanNumber(s string) (int64, error) {
 	return n, nil
 }
 
-func getAWSSession() (*session.Session, error) {
-	return session.NewSessionWithOptions(
-		session.Options{
-			Config: aws.Config{
-				Endpoint: aws.String(endpoint),
-				Region:   aws.String("us-east-1"),
-				Credentials: credentials.NewStaticCredentials(
-					accessKey, secretKey, ""),
-				DisableSSL:       aws.Bool(true),
-				S3ForcePathStyle: aws.Bool(true)},
-		},
-	)
+// newHTTPClient returns the HTTP client used for all requests to
+// the service endpoint.
+func newHTTPClient() *http.Client {
+	var rt http.RoundTripper = newTransport()
+	if conns != nil {
+		rt = &connCountingTransport{next: rt}
+	}
+	if limiter != nil {
+		rt = &throttleCountingTransport{next: rt}
+	}
+	if faults.enabled() {
+		rt = newFaultTransport(rt)
+	}
+	return &http.Client{Transport: rt}
 }
 
-var (
-	errWorkerSucc = errors.New("Worker is exiting with success.")
-	errWorkerQuit = errors.New("Worker is quitting due to quit signal.")
-)
+// newTransport returns the transport of the HTTP clients, with the
+// -dial-timeout, -tcp-nodelay and -buffer-size.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			err = &dialTimeoutError{addr: addr, err: err}
+		}
+		// the dialer enables TCP_NODELAY once connected, after any
+		// Control function, so it is only changed here.
+		if tc, ok := conn.(*net.TCPConn); ok && err == nil && !tcpNoDelay {
+			if err = tc.SetNoDelay(false); err != nil {
+				tc.Close()
+				return nil, err
+			}
+		}
+		return conn, err
+	}
+	if bufferSize > 0 {
+		transport.WriteBufferSize = int(bufferSize)
+		transport.ReadBufferSize = int(bufferSize)
+	}
+	return transport
+}
 
-type workerMsg struct {
-	// If exitingErr != nil -> worker is quitting with an error
-	// value.
-	exitingErr error
+// connTracker counts the connections requests are sent on during
+// the test, by whether they are new or reused.
+type connTracker struct {
+	mu sync.Mutex
 
-	// Sends time at which putobject was successful
-	putStartTime time.Time
-	putDuration  time.Duration
+	// start of the test - connections are only counted once it
+	// is set.
+	start time.Time
+
+	newConns    int64
+	reusedConns int64
+
+	// number of new connections in each second of the test.
+	secondNew []int64
 }
 
-func workerLoop(objSize int64, workerMsgCh chan<- workerMsg, quitChan <-chan struct{}) {
-	session, err := getAWSSession()
-	if err != nil {
-		workerMsgCh <- workerMsg{exitingErr: err}
+// connections of the requests, with -conn-stats - nil if disabled.
+var conns *connTracker
+
+// startTest starts counting connections from the test start t.
+func (ct *connTracker) startTest(t time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.start = t
+}
+
+// gotConn counts the connection a request is sent on.
+func (ct *connTracker) gotConn(info httptrace.GotConnInfo) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.start.IsZero() {
+		return
+	}
+	if info.Reused {
+		ct.reusedConns++
 		return
 	}
+	ct.newConns++
+	sec := int(time.Since(ct.start) / time.Second)
+	for len(ct.secondNew) <= sec {
+		ct.secondNew = append(ct.secondNew, 0)
+	}
+	ct.secondNew[sec]++
+}
 
-	uploader := func(doneCh chan<- workerMsg) {
-		object := NewRandomObjectWithSize(objSize)
-		startTime := time.Now().UTC()
+// connCountingTransport counts the new and reused connections of
+// the requests in conns.
+type connCountingTransport struct {
+	next http.RoundTripper
+}
 
-		s3Client := s3.New(session)
+func (ct *connCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{GotConn: conns.gotConn}
+	return ct.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
 
-		_, err = s3Client.PutObject(&s3.PutObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(object.ObjectName),
-			Body:   &object,
-		})
-		duration := time.Since(startTime)
+// faultConfig configures the faults injected into requests.
+type faultConfig struct {
+	// fraction of requests that fail with errInjectedFault.
+	errorRate float64
+
+	// fraction of requests that are delayed by delay.
+	delayRate float64
+	delay     time.Duration
+}
+
+func (fc faultConfig) enabled() bool {
+	return fc.errorRate > 0 || fc.delayRate > 0
+}
+
+// parseFaultConfig parses a fault injection spec of the form
+// "error=0.01,delay=0.05,delay-time=500ms".
+func parseFaultConfig(spec string) (fc faultConfig, err error) {
+	fc.delay = time.Second
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return fc, fmt.Errorf("invalid fault setting %q", kv)
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "error":
+			fc.errorRate, err = strconv.ParseFloat(parts[1], 64)
+		case "delay":
+			fc.delayRate, err = strconv.ParseFloat(parts[1], 64)
+		case "delay-time":
+			fc.delay, err = time.ParseDuration(parts[1])
+		default:
+			return fc, fmt.Errorf("unknown fault setting %q", parts[0])
+		}
 		if err != nil {
-			err = fmt.Errorf("PutObject Error for bucket %v and key %v - %v", bucket, object.ObjectName, err)
+			return fc, fmt.Errorf("invalid fault setting %q", kv)
 		}
-		doneCh <- workerMsg{err, startTime, duration}
 	}
-
-	// buffered channel so that uploader go routine does not hang.
-	doneCh := make(chan workerMsg, 1)
-	uploadCount := 0
-	timeStart := time.Now().UTC()
-	go uploader(doneCh)
-	toQuit := false
-	for !toQuit {
-		select {
-		case uploadMsg := <-doneCh:
-			workerMsgCh <- uploadMsg
-			if uploadMsg.exitingErr != nil {
-				toQuit = true
-			} else {
-				uploadCount++
-				if time.Since(timeStart) < workerDuration ||
-					uploadCount < minUploadCount {
-					go uploader(doneCh)
-				} else {
-					workerMsgCh <- workerMsg{
-						exitingErr: errWorkerSucc,
-					}
-					toQuit = true
-				}
-			}
-		case <-quitChan:
-			workerMsgCh <- workerMsg{
-				exitingErr: errWorkerQuit,
-			}
-			toQuit = true
-		}
+	if fc.errorRate < 0 || fc.delayRate < 0 || fc.errorRate+fc.delayRate > 1 {
+		return fc, errors.New("fault rates must be between 0 and 1")
 	}
+	return fc, nil
 }
 
-type TestResult struct {
-	// putStartTime []time.Time
-	// putDuration  []time.Duration
-
-	startTime   time.Time
-	objectSize  int64
-	objectCount int64
-}
+var errInjectedFault = errors.New("injected fault")
 
-func (tr *TestResult) getTRMessage() string {
-	timeSoFar := time.Now().UTC().Sub(tr.startTime).Seconds()
-	bandwidthMiBps := float64(tr.objectCount) * float64(tr.objectSize) /
-		(timeSoFar * 1024 * 1024)
-	objps := float64(tr.objectCount) / timeSoFar
+// number of faults injected so far.
+var injectedErrors, injectedDelays int64
 
-	totalDataWrittenMiB := float64(tr.objectCount*tr.objectSize) /
-		float64(1024*1024)
+// faultTransport injects errors and delays into requests, to test
+// the program's handling of failing requests without a failing
+// server.
+type faultTransport struct {
+	next http.RoundTripper
 
-	return fmt.Sprintf("At %.2f: Avg data b/w: %.2f MiBps. Avg obj/s: %.2f. Data Written: %0.2f MiB in %v objects.\n",
-		timeSoFar, bandwidthMiBps, objps, totalDataWrittenMiB,
-		tr.objectCount)
+	mu   sync.Mutex
+	rand *rand.Rand
 }
 
-func printRoutine(msgCh chan string, printerDoneCh chan struct{}) {
-	for msg := range msgCh {
-		fmt.Print(msg)
+func newFaultTransport(next http.RoundTripper) *faultTransport {
+	return &faultTransport{
+		next: next,
+		rand: rand.New(rand.NewSource(randomSeed)),
 	}
-	printerDoneCh <- struct{}{}
 }
 
-func launchTest(objSize int64) (tr TestResult, err error) {
-	setMaxObjects(objSize)
-	generateNames()
+func (ft *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ft.mu.Lock()
+	p := ft.rand.Float64()
+	ft.mu.Unlock()
 
-	// try to create bucket in case it doesnt exist.
-	session, err := getAWSSession()
-	if err != nil {
-		return TestResult{}, err
+	switch {
+	case p < faults.errorRate:
+		atomic.AddInt64(&injectedErrors, 1)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errInjectedFault
+	case p < faults.errorRate+faults.delayRate:
+		atomic.AddInt64(&injectedDelays, 1)
+		select {
+		case <-time.After(faults.delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
 	}
-	s3Client := s3.New(session)
+	return ft.next.RoundTrip(req)
+}
 
-	// ignore error as it is most likely that the bucket exists.
-	_, _ = s3Client.CreateBucket(&s3.CreateBucketInput{
-		Bucket: aws.String(bucket),
+// isInjectedFault returns whether err was caused by an injected
+// fault.
+func isInjectedFault(err error) bool {
+	return hasCause(err, func(cause error) bool {
+		return cause == errInjectedFault
 	})
+}
 
-	workerMsgCh := make(chan workerMsg)
+// hasCause returns whether match is true for err or any error in
+// its chain, following both wrapped errors and the original errors
+// of SDK errors.
+func hasCause(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			err = aerr.OrigErr()
+			continue
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
 
-	// channels to print asynch.
-	// buffer upto 100 messages
-	printMsgCh := make(chan string, 100)
-	printerDoneCh := make(chan struct{})
-	go printRoutine(printMsgCh, printerDoneCh)
+// dialTimeoutError is returned when a connection to the endpoint
+// could not be established within the dial timeout.
+type dialTimeoutError struct {
+	addr string
+	err  error
+}
 
-	// quitCh is buffered as some workers may have quit due to
-	// errors when we send the quit signal.
-	quitCh := make(chan struct{}, concurrency)
+func (e *dialTimeoutError) Error() string {
+	return fmt.Sprintf("dial timeout connecting to %v - %v", e.addr, e.err)
+}
 
-	// Start workers
-	for i := 0; i < concurrency; i++ {
-		go workerLoop(objSize, workerMsgCh, quitCh)
+func (e *dialTimeoutError) Unwrap() error   { return e.err }
+func (e *dialTimeoutError) Timeout() bool   { return true }
+func (e *dialTimeoutError) Temporary() bool { return true }
+
+// error classes
+const (
+	errClassDNS         = "DNS failure"
+	errClassDialTimeout = "dial timeout"
+	errClassOpTimeout   = "operation timeout"
+	errClassInjected    = "injected fault"
+)
+
+// errorClass returns the class of a failed operation's error, or an
+// empty string for other errors.
+func errorClass(err error) string {
+	switch {
+	case isInjectedFault(err):
+		return errClassInjected
+	case isDNSError(err):
+		// also if resolving timed out.
+		return errClassDNS
+	case hasCause(err, func(cause error) bool {
+		_, ok := cause.(*dialTimeoutError)
+		return ok
+	}):
+		return errClassDialTimeout
+	case opTimeout > 0 && hasCause(err, func(cause error) bool {
+		aerr, ok := cause.(awserr.Error)
+		return ok && aerr.Code() == request.CanceledErrorCode
+	}):
+		return errClassOpTimeout
 	}
+	return ""
+}
 
-	// collect results and wait for workers to quit.
-	numWorkersQuit := 0
-	isQuitting := false
-	eachInterval := time.After(time.Second * 10)
-	tr.startTime = time.Now().UTC()
-	tr.objectSize = objSize
-	var hadUploadError error
-	for numWorkersQuit < concurrency {
-		select {
-		case wMsg := <-workerMsgCh:
-			switch {
-			case wMsg.exitingErr == errWorkerSucc:
-				fallthrough
-			case wMsg.exitingErr == errWorkerQuit:
-				numWorkersQuit++
-			case wMsg.exitingErr != nil:
-				fmt.Printf("An upload attempt errored with \"%v\" - aborting test!\n", wMsg.exitingErr)
-				hadUploadError = wMsg.exitingErr
-				numWorkersQuit++
-				if !isQuitting {
-					isQuitting = true
-					for i := 0; i < concurrency; i++ {
-						quitCh <- struct{}{}
-					}
-				}
+// isDNSError returns whether err was caused by a failure to resolve
+// a host name.
+func isDNSError(err error) bool {
+	return hasCause(err, func(cause error) bool {
+		_, ok := cause.(*net.DNSError)
+		return ok
+	})
+}
+
+// newRunID returns a unique id for a run made of the current time
+// and a random suffix. The suffix does not use the seeded random
+// source, so that runs with the same seed get different ids.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := crand.Read(b); err != nil {
+		// fall back to the nanosecond part of the time.
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// readSizeLine reads a single object size from the first line of r.
+func readSizeLine(r io.Reader) (int64, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return parseSizeLine(strings.TrimSpace(line), 1)
+}
+
+// parseSizeLine parses the object size on the given line of stdin,
+// which must not be negative.
+func parseSizeLine(line string, lineNum int) (int64, error) {
+	size, err := parseHumanNumber(line)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q on line %v of stdin", line, lineNum)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("negative size %q on line %v of stdin", line, lineNum)
+	}
+	return size, nil
+}
+
+// readSizes parses one object size per line of r and sends them on
+// sizeCh, which is closed at the end of input. Empty lines are
+// skipped. On an invalid line, the error is sent on errCh and
+// reading stops.
+func readSizes(r io.Reader, sizeCh chan<- int64, errCh chan<- error) {
+	defer close(sizeCh)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		size, err := parseSizeLine(line, lineNum)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		sizeCh <- size
+	}
+	if err := scanner.Err(); err != nil {
+		errCh <- err
+	}
+}
+
+// s3Endpoint is a service endpoint of the test.
+type s3Endpoint struct {
+	host   string
+	secure bool
+
+	// relative share of the operations sent to the endpoint, if
+	// given with the endpoint.
+	weight float64
+}
+
+func (ep s3Endpoint) String() string {
+	if ep.secure {
+		return "https://" + ep.host
+	}
+	return "http://" + ep.host
+}
+
+// parseEndpoints parses a comma separated list of endpoints. Each
+// endpoint is a host with an optional http:// or https:// scheme;
+// endpoints without a scheme use https if defaultSecure is set. An
+// endpoint may be followed by a weight, e.g. "a:9000=3"; if any
+// endpoint has one, the others have a weight of 1.
+func parseEndpoints(spec string, defaultSecure bool) ([]s3Endpoint, error) {
+	var eps []s3Endpoint
+	weighted := false
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		weight := 1.0
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			w, err := strconv.ParseFloat(entry[i+1:], 64)
+			if err != nil || w <= 0 || math.IsInf(w, 0) {
+				return nil, fmt.Errorf("invalid weight in endpoint %q", entry)
+			}
+			entry, weight, weighted = entry[:i], w, true
+		}
+		// the zone of an IPv6 address may be escaped as in URLs.
+		ep := s3Endpoint{host: strings.Replace(entry, "%25", "%", 1), secure: defaultSecure, weight: weight}
+		if strings.Contains(entry, "://") {
+			u, err := url.Parse(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid endpoint %q", entry)
+			}
+			switch u.Scheme {
+			case "http":
+				ep.secure = false
+			case "https":
+				ep.secure = true
 			default:
-				// got a successful upload msg.
-				// tRes.putStartTime = append(tRes.putStartTime, wMsg.putStartTime)
-				// tRes.putDuration = append(tRes.putDuration, wMsg.putDuration)
+				return nil, fmt.Errorf("unknown scheme in endpoint %q", entry)
+			}
+			if u.Path != "" && u.Path != "/" {
+				return nil, fmt.Errorf("endpoint %q must not have a path", entry)
+			}
+			ep.host = u.Host
+		}
+		host, err := normalizeHost(ep.host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q - %w", entry, err)
+		}
+		ep.host = host
+		eps = append(eps, ep)
+	}
+	if !weighted {
+		for i := range eps {
+			eps[i].weight = 0
+		}
+	}
+	return eps, nil
+}
+
+// endpointsWeighted returns whether the endpoints were given with
+// weights, so that each operation picks its endpoint by weight.
+func endpointsWeighted() bool {
+	return endpoints[0].weight > 0
+}
+
+// pickEndpoint returns the index of an endpoint picked at random by
+// weight.
+func pickEndpoint(r *rand.Rand) int {
+	var total float64
+	for _, ep := range endpoints {
+		total += ep.weight
+	}
+	x := r.Float64() * total
+	for i, ep := range endpoints {
+		if x < ep.weight {
+			return i
+		}
+		x -= ep.weight
+	}
+	return len(endpoints) - 1
+}
+
+// getWorkerSessions returns the sessions of the endpoints a worker
+// sends its operations to: the one it is assigned to, or all of them
+// if the endpoints are weighted.
+func getWorkerSessions(workerID int) ([]*session.Session, error) {
+	if !endpointsWeighted() {
+		sess, err := getEndpointSession(endpoints[workerEndpoints[workerID]])
+		return []*session.Session{sess}, err
+	}
+	sessions := make([]*session.Session, len(endpoints))
+	for i, ep := range endpoints {
+		var err error
+		if sessions[i], err = getEndpointSession(ep); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
 
-				tr.objectCount++
+// normalizeHost checks a host with an optional port, and returns it
+// in the form used in URLs: IPv6 addresses are enclosed in brackets,
+// e.g. "::1" becomes "[::1]", and "[::1]:9000" is kept. The zone of
+// an IPv6 address is escaped, e.g. "fe80::1%eth0" becomes
+// "[fe80::1%25eth0]".
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if h == "" || port == "" {
+			return "", errors.New("missing host or port")
+		}
+		if strings.Contains(h, ":") {
+			if h, err = ipv6URLForm(h); err != nil {
+				return "", err
 			}
+		}
+		return net.JoinHostPort(h, port), nil
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		h, err := ipv6URLForm(host[1 : len(host)-1])
+		if err != nil {
+			return "", err
+		}
+		return "[" + h + "]", nil
+	}
+	if strings.Contains(host, ":") {
+		// a bare IPv6 address, without a port.
+		h, err := ipv6URLForm(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host %q - enclose IPv6 addresses with a port in brackets, e.g. [::1]:9000", host)
+		}
+		return "[" + h + "]", nil
+	}
+	return host, nil
+}
 
-		// print messages about the running test each second.
-		case <-eachInterval:
-			// print via a separate go routine so as to
-			// not block the for loop for printing.
-			printMsgCh <- tr.getTRMessage()
-			eachInterval = time.After(time.Second * 10)
+// ipv6URLForm checks an IPv6 address with an optional zone, and
+// returns it with the % before the zone escaped, as in URLs.
+func ipv6URLForm(h string) (string, error) {
+	addr, zone, zoned := strings.Cut(h, "%")
+	if net.ParseIP(addr) == nil || (zoned && zone == "") {
+		return "", fmt.Errorf("invalid IPv6 address %q", h)
+	}
+	if zoned {
+		return addr + "%25" + zone, nil
+	}
+	return addr, nil
+}
+
+// open files used besides the connections of the workers - standard
+// streams, output files, live feed clients and lingering connections.
+const reservedOpenFiles = 64
+
+// neededOpenFiles estimates the number of open files of the test -
+// a connection per worker, and a file per worker with
+// -per-worker-output.
+func neededOpenFiles() uint64 {
+	need := uint64(concurrency)
+	if perWorkerDir != "" {
+		need += uint64(concurrency)
+	}
+	return need + reservedOpenFiles
+}
+
+// checkEndpoints checks that a connection can be made to each
+// endpoint.
+func checkEndpoints(eps []s3Endpoint) error {
+	for _, ep := range eps {
+		// parsing the URL removes the brackets of an IPv6 address
+		// and unescapes its zone.
+		u, err := url.Parse(ep.String())
+		if err != nil {
+			return fmt.Errorf("invalid endpoint %v - %w", ep, err)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if ep.secure {
+				port = "443"
+			}
 		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), dialTimeout)
+		if err != nil {
+			return fmt.Errorf("endpoint %v is not reachable - %w", ep, err)
+		}
+		conn.Close()
 	}
+	return nil
+}
 
-	// Close and confirm the printing channel exits.
-	close(printMsgCh)
-	<-printerDoneCh
+// index of the endpoint used by each worker.
+var workerEndpoints []int
 
-	return tr, hadUploadError
+// splitWorkers returns the index of the endpoint of each of n
+// workers. spec gives the percentage of the workers that use each
+// endpoint, e.g. "70/30" - if it is empty, the workers are spread
+// evenly over the endpoints.
+func splitWorkers(spec string, numEndpoints, n int) ([]int, error) {
+	assigned := make([]int, n)
+	if spec == "" {
+		for i := range assigned {
+			assigned[i] = i % numEndpoints
+		}
+		return assigned, nil
+	}
+	parts := strings.Split(spec, "/")
+	if len(parts) != numEndpoints {
+		return nil, fmt.Errorf("%v percentages given for %v endpoints", len(parts), numEndpoints)
+	}
+	var total float64
+	counts := make([]int, len(parts))
+	for i, part := range parts {
+		pct, err := strconv.ParseFloat(part, 64)
+		if err != nil || pct < 0 {
+			return nil, fmt.Errorf("invalid percentage %q", part)
+		}
+		total += pct
+		counts[i] = int(math.Round(pct / 100 * float64(n)))
+	}
+	if math.Abs(total-100) > 1e-9 {
+		return nil, fmt.Errorf("percentages add up to %v instead of 100", total)
+	}
+	// the last endpoint takes the workers left over by rounding.
+	i := 0
+	for ep, count := range counts {
+		if ep == len(counts)-1 {
+			count = n - i
+		}
+		for ; count > 0 && i < n; count-- {
+			assigned[i] = ep
+			i++
+		}
+	}
+	return assigned, nil
 }
 
-/*
+// number of retries of requests by the SDK, and the total time spent
+// in backoff before them, updated atomically.
+var retryCount, backoffTotal int64
 
-Worker Algo:
+// backoffRetryer is the SDK's default retryer, with the backoff set
+// by -retry-base, -retry-max and -retry-jitter, that counts the
+// retries and the time spent in backoff.
+type backoffRetryer struct {
+	client.DefaultRetryer
+}
 
-1. Generate objects of specified size, and upload sequentially to
-service.
+func newBackoffRetryer() backoffRetryer {
+	maxRetries := sdkRetries
+	if maxRetries == aws.UseServiceDefaultRetries {
+		maxRetries = client.DefaultRetryerMaxNumRetries
+	}
+	return backoffRetryer{client.DefaultRetryer{NumMaxRetries: maxRetries}}
+}
 
-2. Report each success via a channel
+// RetryRules returns the delay before retrying the request. The
+// delay doubles with each retry from -retry-base up to -retry-max;
+// with jitter, it is picked uniformly between half and all of that.
+func (br backoffRetryer) RetryRules(r *request.Request) time.Duration {
+	var delay time.Duration
+	if retryBase == 0 && retryMax == 0 && retryJitter {
+		delay = br.DefaultRetryer.RetryRules(r)
+	} else {
+		base, maxDelay := retryBase, retryMax
+		if base == 0 {
+			base = client.DefaultRetryerMinRetryDelay
+		}
+		if maxDelay == 0 {
+			maxDelay = client.DefaultRetryerMaxRetryDelay
+		}
+		delay = base
+		for i := 0; i < r.RetryCount && delay < maxDelay; i++ {
+			delay *= 2
+		}
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		if retryJitter {
+			delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		}
+	}
+	atomic.AddInt64(&retryCount, 1)
+	atomic.AddInt64(&backoffTotal, int64(delay))
+	return delay
+}
 
-3. Terminate on:
-   a. Error, or
-   b. 15 minutes pass and at least 50 objects are uploaded.
-   c. Receiving signal to quit.
+// number of request attempts that failed to resolve the endpoint,
+// updated atomically.
+var dnsFailures int64
 
-In the main thread, setup required number of worker threads, and:
+// countDNSFailure counts the failed request attempt if it failed to
+// resolve the endpoint.
+func countDNSFailure(r *request.Request) {
+	if isDNSError(r.Error) {
+		atomic.AddInt64(&dnsFailures, 1)
+	}
+}
 
-1. Record each success and calculate objects/second metric.
+// retryDNSFailure retries a request that failed to resolve the
+// endpoint after the SDK gave up on it, with the backoff of the
+// retryer, until -dns-retry-timeout has passed since the request was
+// created. It runs after the SDK's retry handler, which clears the
+// error if it retries the request itself.
+func retryDNSFailure(r *request.Request) {
+	if r.Error == nil || !isDNSError(r.Error) {
+		return
+	}
+	remaining := dnsRetryTimeout - time.Since(r.Time)
+	if remaining <= 0 {
+		return
+	}
+	delay := r.RetryRules(r)
+	if delay > remaining {
+		delay = remaining
+	}
+	if err := aws.SleepWithContext(r.Context(), delay); err != nil {
+		// the operation timed out - fail with the DNS error.
+		return
+	}
+	r.RetryCount++
+	r.Retryable = aws.Bool(true)
+	r.Error = nil
+}
 
-2. On error, signal all workers to quit.
+// getDNSMessage reports the request attempts that failed to resolve
+// the endpoint.
+func getDNSMessage() string {
+	count := atomic.LoadInt64(&dnsFailures)
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v request attempts failed to resolve the endpoint.\n", count)
+}
 
-3. Wait for threads to quit, and report metrics.
+// getRetryMessage reports the retries of requests and the time spent
+// in backoff before them, summed over all workers.
+func getRetryMessage() string {
+	count := atomic.LoadInt64(&retryCount)
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Retried %v requests, with %v spent in backoff in total.\n",
+		count, time.Duration(atomic.LoadInt64(&backoffTotal)))
+}
 
-*/
+// getAWSSession returns a session for the first endpoint.
+func getAWSSession() (*session.Session, error) {
+	return getEndpointSession(endpoints[0])
+}
 
-func init() {
-	flag.StringVar(&endpoint, "h", "localhost:9000", "service endpoint host")
-	flag.BoolVar(&secure, "s", false, "Set if endpoint requires https")
-	flag.StringVar(&bucket, "bucket", "bucket", "Bucket to use for uploads test")
-	flag.IntVar(&concurrency, "c", 1, "concurrency - number of parallel uploads")
-	flag.Int64Var(&randomSeed, "seed", defaultRandomSeed, "random seed")
-	flag.IntVar(&maxDiskUsageGB, "m", 80, "Maximum amount of disk usage in GBs")
+func getEndpointSession(ep s3Endpoint) (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(
+		session.Options{
+			Config: aws.Config{
+				Endpoint: aws.String(ep.host),
+				Region:   aws.String("us-east-1"),
+				Credentials: credentials.NewStaticCredentials(
+					accessKey, secretKey, ""),
+				DisableSSL:       aws.Bool(!ep.secure),
+				S3ForcePathStyle: aws.Bool(true),
+				HTTPClient:       httpClient,
+				MaxRetries:       aws.Int(sdkRetries),
+				Retryer:          newBackoffRetryer()},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler("minio-perftest-run/" + runID))
+	sess.Handlers.Retry.PushBack(countDNSFailure)
+	if dnsRetryTimeout > 0 {
+		sess.Handlers.AfterRetry.PushBack(retryDNSFailure)
+	}
+	if opTimeout > 0 {
+		// bound each operation, including its retries.
+		sess.Handlers.Validate.PushFront(func(r *request.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), opTimeout)
+			r.SetContext(ctx)
+			r.Handlers.Complete.PushBack(func(*request.Request) { cancel() })
+		})
+	}
+	return sess, nil
 }
 
-func main() {
-	flag.Parse()
+// multipartTiming records the latency of each step of a multipart
+// upload, with -manual-multipart.
+type multipartTiming struct {
+	create time.Duration
+	parts  []time.Duration
 
-	if flag.NArg() != 1 {
-		fmt.Println("Usage: ./minio-perftest [flags] UPLOADS_SIZE")
-		os.Exit(1)
+	// zero if the upload was not completed.
+	complete time.Duration
+}
+
+// multipartLatencies collects the latencies of the steps of multipart
+// uploads.
+type multipartLatencies struct {
+	create   []time.Duration
+	parts    []time.Duration
+	complete []time.Duration
+}
+
+func (ml *multipartLatencies) add(t *multipartTiming) {
+	ml.create = append(ml.create, t.create)
+	ml.parts = append(ml.parts, t.parts...)
+	if t.complete > 0 {
+		ml.complete = append(ml.complete, t.complete)
+	}
+}
+
+func (ml *multipartLatencies) merge(o *multipartLatencies) {
+	ml.create = append(ml.create, o.create...)
+	ml.parts = append(ml.parts, o.parts...)
+	ml.complete = append(ml.complete, o.complete...)
+}
+
+// multipartSummary summarizes the latencies of the steps of
+// multipart uploads.
+type multipartSummary struct {
+	Create   latencySummary `json:"create"`
+	Part     latencySummary `json:"part"`
+	Complete latencySummary `json:"complete"`
+}
+
+// sortDurations returns a sorted copy of d.
+func sortDurations(d []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// getMultipartMessage reports the latencies of the steps of
+// multipart uploads, with -manual-multipart.
+func (tr *TestResult) getMultipartMessage() string {
+	if !manualMultipart || len(tr.multipart.create) == 0 {
+		return ""
 	}
+	steps := []struct {
+		name      string
+		latencies []time.Duration
+	}{
+		{"Create", tr.multipart.create},
+		{"Part upload", tr.multipart.parts},
+		{"Complete", tr.multipart.complete},
+	}
+	var msg string
+	for _, step := range steps {
+		if len(step.latencies) == 0 {
+			continue
+		}
+		msg += fmt.Sprintf("%v latency (%v requests): %v\n", step.name,
+			len(step.latencies), getPercentilesMessage(sortDurations(step.latencies)))
+	}
+	return msg
+}
 
-	// parse command line argument
-	size, err := parseHumanNumber(flag.Arg(0))
+// multipartUpload uploads the object in parts of partSize bytes. If
+// abandon is set, only some of the parts, as many as picked with r,
+// are uploaded and the upload is left incomplete on the server. If
+// timing is not nil, the latency of each request is recorded in it.
+func multipartUpload(s3Client *s3.S3, bucket string, object *ObjGen, abandon bool, r *rand.Rand, timing *multipartTiming) error {
+	start := time.Now()
+	createOut, err := s3Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object.ObjectName),
+	})
 	if err != nil {
-		fmt.Println("Usage: ./minio-perftest [flags] UPLOADS_SIZE")
-		fmt.Println("\nUPLOADS_SIZE examples: 100, 1MB, 10KiB, etc")
-		os.Exit(1)
+		return err
+	}
+	if timing != nil {
+		timing.create = time.Since(start)
 	}
 
-	// set random seed for this run
-	rand.Seed(randomSeed)
+	numParts := (object.ObjectSize + partSize - 1) / partSize
+	if numParts == 0 {
+		numParts = 1
+	}
+	if abandon {
+		numParts = 1 + r.Int63n(numParts)
+	}
+	parts := make([]*s3.CompletedPart, 0, numParts)
+	for i := int64(0); i < numParts; i++ {
+		offset := i * partSize
+		length := object.ObjectSize - offset
+		if length > partSize {
+			length = partSize
+		}
+		start = time.Now()
+		partOut, err := s3Client.UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(object.ObjectName),
+			UploadId:   createOut.UploadId,
+			PartNumber: aws.Int64(i + 1),
+			Body:       io.NewSectionReader(object, offset, length),
+		})
+		if err != nil {
+			return err
+		}
+		if timing != nil {
+			timing.parts = append(timing.parts, time.Since(start))
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       partOut.ETag,
+			PartNumber: aws.Int64(i + 1),
+		})
+	}
+	if abandon {
+		// just drop the upload - it is left for the server to
+		// clean up.
+		return nil
+	}
 
-	// launch test
-	result, err := launchTest(size)
+	start = time.Now()
+	_, err = s3Client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(object.ObjectName),
+		UploadId:        createOut.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err == nil && timing != nil {
+		timing.complete = time.Since(start)
+	}
+	return err
+}
+
+// checksum algorithms of -checksum
+const (
+	checksumCRC32C    = "crc32c"
+	checksumSHA256    = "sha256"
+	checksumCRC64NVME = "crc64nvme"
+)
+
+// crc64NVMETable is the table of the CRC-64/NVME polynomial, in the
+// reversed form used by hash/crc64.
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// checksumHeader returns the header that carries a checksum of the
+// checksumAlgorithm, and a new hash computing it.
+func checksumHeader() (string, hash.Hash) {
+	switch checksumAlgorithm {
+	case checksumCRC32C:
+		return "X-Amz-Checksum-Crc32c", crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case checksumSHA256:
+		return "X-Amz-Checksum-Sha256", sha256.New()
+	case checksumCRC64NVME:
+		return "X-Amz-Checksum-Crc64nvme", crc64.New(crc64NVMETable)
+	}
+	return "", nil
+}
+
+// objectChecksum computes the checksum of the object's content with
+// the checksumAlgorithm, and returns its header and base64 encoded
+// value. As the content is generated, this streams it without
+// buffering, and leaves the object's read position alone.
+func objectChecksum(object *ObjGen) (string, string, error) {
+	header, h := checksumHeader()
+	if _, err := io.Copy(h, io.NewSectionReader(object, 0, object.ObjectSize)); err != nil {
+		return "", "", err
+	}
+	return header, base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// putObjectWithChecksum uploads an object with the given checksum
+// header. The aws-sdk-go version used cannot send checksums in a
+// trailer, so the checksum is sent as a header.
+func putObjectWithChecksum(s3Client *s3.S3, input *s3.PutObjectInput, header, value string) (*request.Request, error) {
+	req, _ := s3Client.PutObjectRequest(input)
+	req.HTTPRequest.Header.Set(header, value)
+	return req, req.Send()
+}
+
+// checkChecksumSupport uploads a small object with a checksum to
+// check that the server supports the checksumAlgorithm, and removes
+// it again. A server that ignores the checksum is reported with a
+// warning, as the test would not exercise its validation.
+func checkChecksumSupport(s3Client *s3.S3) error {
+	seedBytes := []byte(getAlNumPerm(rand.New(rand.NewSource(randomSeed))))
+	object := newObjGen("minio-perftest-checksum-check-"+runID, 1024, seedBytes)
+	header, value, err := objectChecksum(&object)
 	if err != nil {
-		fmt.Println("Quit due to errors:", err)
-		os.Exit(1)
+		return err
+	}
+	req, err := putObjectWithChecksum(s3Client, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object.ObjectName),
+		Body:   &object,
+	}, header, value)
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.StatusCode() == http.StatusNotImplemented,
+			reqErr.Code() == "NotImplemented",
+			reqErr.Code() == "InvalidArgument",
+			reqErr.Code() == "InvalidRequest":
+			return fmt.Errorf("The %v checksum is unsupported by the server - %w", checksumAlgorithm, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+	}
+	if req.HTTPResponse.Header.Get(header) == "" {
+		fmt.Printf("Warning: the server did not return the %v checksum, it may not validate it.\n", checksumAlgorithm)
+	}
+	return deleteObject(s3Client, bucket, object.ObjectName)
+}
+
+// removeIncompleteUploads aborts all incomplete multipart uploads in
+// the bucket and returns the number of uploads removed.
+func removeIncompleteUploads() (int, error) {
+	session, err := getAWSSession()
+	if err != nil {
+		return 0, err
+	}
+	s3Client := s3.New(session)
+
+	var uploads []*s3.MultipartUpload
+	err = s3Client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		uploads = append(uploads, page.Uploads...)
+		return true
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	fmt.Print(result.getTRMessage())
+	prog := startProgress("Removing incomplete uploads", int64(len(uploads)))
+	defer prog.finish()
+	removed := 0
+	for _, upload := range uploads {
+		_, err = s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			return removed, err
+		}
+		removed++
+		prog.add(1)
+	}
+	return removed, nil
+}
+
+// workloadMix is a weighted mix of operation types.
+type workloadMix struct {
+	opTypes []string
+	weights []int
+	total   int
+}
+
+// parseWorkload parses a workload given as comma separated
+// operation:weight pairs, e.g. "get:80,put:15,delete:5".
+func parseWorkload(spec string) (w workloadMix, err error) {
+	seen := make(map[string]bool)
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(kv, ":", 2)
+		if len(parts) != 2 {
+			return w, fmt.Errorf("invalid workload entry %q", kv)
+		}
+		opType := strings.TrimSpace(parts[0])
+		switch opType {
+		case opPut, opGet, opDelete, opStat:
+		default:
+			return w, fmt.Errorf("unknown operation %q", opType)
+		}
+		if seen[opType] {
+			return w, fmt.Errorf("operation %q given more than once", opType)
+		}
+		seen[opType] = true
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight < 0 {
+			return w, fmt.Errorf("invalid weight in workload entry %q", kv)
+		}
+		if weight == 0 {
+			continue
+		}
+		w.opTypes = append(w.opTypes, opType)
+		w.weights = append(w.weights, weight)
+		w.total += weight
+	}
+	if w.total == 0 {
+		return w, errors.New("workload has no operation with a positive weight")
+	}
+	return w, nil
+}
+
+// weightOf returns the weight of the operation type.
+func (w workloadMix) weightOf(opType string) int {
+	for i, t := range w.opTypes {
+		if t == opType {
+			return w.weights[i]
+		}
+	}
+	return 0
+}
+
+// pick returns a random operation type according to the weights.
+func (w workloadMix) pick(r *rand.Rand) string {
+	n := r.Intn(w.total)
+	for i, weight := range w.weights {
+		if n < weight {
+			return w.opTypes[i]
+		}
+		n -= weight
+	}
+	return w.opTypes[len(w.opTypes)-1]
+}
+
+// keySet is a set of object keys that supports picking a random key.
+type keySet struct {
+	mu    sync.Mutex
+	keys  []string
+	index map[string]int
+
+	// keys taken from the set that are still in use, e.g. being
+	// deleted, and the number of times each key was taken.
+	taken     map[string]bool
+	takeCount map[string]int
+}
+
+func newKeySet() *keySet {
+	return &keySet{
+		index:     make(map[string]int),
+		taken:     make(map[string]bool),
+		takeCount: make(map[string]int),
+	}
+}
+
+// add adds key to the set, unless it is taken: an upload that races
+// with the deletion of its key may or may not leave the object, so
+// the key is left out.
+func (ks *keySet) add(key string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if _, ok := ks.index[key]; ok || ks.taken[key] {
+		return
+	}
+	ks.index[key] = len(ks.keys)
+	ks.keys = append(ks.keys, key)
+}
+
+// remove removes key from the set; must be called with ks.mu held.
+func (ks *keySet) remove(key string) {
+	i, ok := ks.index[key]
+	if !ok {
+		return
+	}
+	last := len(ks.keys) - 1
+	ks.keys[i] = ks.keys[last]
+	ks.index[ks.keys[i]] = i
+	ks.keys = ks.keys[:last]
+	delete(ks.index, key)
+}
+
+// random returns a random key from the set, or false if the set is
+// empty.
+func (ks *keySet) random(r *rand.Rand) (string, bool) {
+	key, _, ok := ks.randomCounted(r)
+	return key, ok
+}
+
+// randomCounted is like random, but also returns the number of times
+// the key was taken so far, for takenSince.
+func (ks *keySet) randomCounted(r *rand.Rand) (string, int, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if len(ks.keys) == 0 {
+		return "", 0, false
+	}
+	key := ks.keys[r.Intn(len(ks.keys))]
+	return key, ks.takeCount[key], true
+}
+
+// take removes a random key from the set and returns it, or false
+// if the set is empty. The key is not added again until done is
+// called with it.
+func (ks *keySet) take(r *rand.Rand) (string, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if len(ks.keys) == 0 {
+		return "", false
+	}
+	key := ks.keys[r.Intn(len(ks.keys))]
+	ks.remove(key)
+	ks.taken[key] = true
+	ks.takeCount[key]++
+	return key, true
+}
+
+// done releases a key returned by take.
+func (ks *keySet) done(key string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	delete(ks.taken, key)
+}
+
+// takenSince returns whether key was taken since randomCounted
+// returned it with count.
+func (ks *keySet) takenSince(key string, count int) bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.takeCount[key] != count
+}
+
+func (ks *keySet) contains(key string) bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	_, ok := ks.index[key]
+	return ok
+}
+
+// newKey returns the key of an object named from one of the generated
+// names under the prefix, picked with r, that is neither in the set
+// nor taken, and counts it like objectKey. It redraws the name up to
+// uniqueNameAttempts times.
+func (ks *keySet) newKey(prefix string, r *rand.Rand) (string, error) {
+	for tries := 0; tries < uniqueNameAttempts; tries++ {
+		name := pickObjectName(r)
+		key, err := clampKey(prefix + name)
+		if err != nil {
+			return "", err
+		}
+		ks.mu.Lock()
+		_, live := ks.index[key]
+		live = live || ks.taken[key]
+		ks.mu.Unlock()
+		if !live {
+			countKey(key != prefix+name || nameTruncated(name))
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("no name of a new object found in %v tries, as most generated names are in use", uniqueNameAttempts)
+}
+
+// getObject downloads the object and returns the number of bytes
+// read.
+func getObject(s3Client *s3.S3, bucket, key string) (int64, error) {
+	out, err := s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+	return io.Copy(io.Discard, out.Body)
+}
+
+// validity of presigned URLs - they are used right away.
+const presignExpiry = 15 * time.Minute
+
+// presignGetObject returns a presigned URL to download the object.
+func presignGetObject(s3Client *s3.S3, bucket, key string) (string, error) {
+	req, _ := s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(presignExpiry)
+}
+
+// downloadURL downloads the object at the presigned URL with the
+// plain HTTP client, and returns its size.
+func downloadURL(presignedURL string) (int64, error) {
+	ctx := context.Background()
+	if opTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return io.Copy(io.Discard, resp.Body)
+}
+
+// statObject returns the size of the object.
+func statObject(s3Client *s3.S3, bucket, key string) (int64, error) {
+	out, err := s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(out.ContentLength), nil
+}
+
+// getObjectAttributes retrieves the checksum, parts and size of the
+// object in one call, and returns its size.
+func getObjectAttributes(s3Client *s3.S3, bucket, key string) (int64, error) {
+	out, err := s3Client.GetObjectAttributes(&s3.GetObjectAttributesInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		ObjectAttributes: aws.StringSlice([]string{
+			s3.ObjectAttributesEtag,
+			s3.ObjectAttributesChecksum,
+			s3.ObjectAttributesObjectParts,
+			s3.ObjectAttributesObjectSize,
+		}),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(out.ObjectSize), nil
+}
+
+// findTieredObjects returns the keys of the objects under
+// restorePrefix that are in a storage class other than the standard
+// one, i.e. that were transitioned to a cold tier.
+func findTieredObjects(s3Client *s3.S3) ([]string, error) {
+	var keys []string
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(restorePrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if class := aws.StringValue(obj.StorageClass); class != "" && class != s3.ObjectStorageClassStandard {
+				keys = append(keys, aws.StringValue(obj.Key))
+			}
+		}
+		return true
+	})
+	return keys, err
+}
+
+// findObjects returns the keys of up to limit objects in the bucket,
+// for the get mode to download existing objects.
+func findObjects(s3Client *s3.S3, limit int) ([]string, error) {
+	var keys []string
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if len(keys) == limit {
+				return false
+			}
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	return keys, err
+}
+
+// restoreObject restores an object from its cold tier and waits
+// until the restored copy is readable. It returns the time taken to
+// initiate the restore.
+func restoreObject(s3Client *s3.S3, key string) (time.Duration, error) {
+	start := time.Now()
+	_, err := s3Client.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:         aws.String(bucket),
+		Key:            aws.String(key),
+		RestoreRequest: &s3.RestoreRequest{Days: aws.Int64(restoreDays)},
+	})
+	initDuration := time.Since(start)
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.Code() == "RestoreAlreadyInProgress":
+			// wait for the running restore.
+			err = nil
+		case reqErr.StatusCode() == http.StatusNotImplemented,
+			reqErr.Code() == "NotImplemented",
+			reqErr.Code() == "XNotImplemented":
+			return 0, fmt.Errorf("RestoreObject is unsupported by the server - %w", err)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		out, err := s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return 0, err
+		}
+		if strings.Contains(aws.StringValue(out.Restore), `ongoing-request="false"`) {
+			return initDuration, nil
+		}
+		if time.Since(start) >= restoreTimeout {
+			return 0, fmt.Errorf("not restored within %v", restoreTimeout)
+		}
+		time.Sleep(restorePoll)
+	}
+}
+
+// waitVisible reads the uploaded object with HEAD requests until one
+// returns the given ETag, and returns the time from start until then
+// and the number of reads.
+func waitVisible(s3Client *s3.S3, key, etag string, start time.Time) (time.Duration, int, error) {
+	for reads := 1; ; reads++ {
+		out, err := s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		var reqErr awserr.RequestFailure
+		if err != nil && !(errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound) {
+			return 0, reads, err
+		}
+		if err == nil && aws.StringValue(out.ETag) == etag {
+			return time.Since(start), reads, nil
+		}
+		if time.Since(start) >= visibilityTimeout {
+			return 0, reads, fmt.Errorf("not visible within %v", visibilityTimeout)
+		}
+		if visibilityPoll > 0 {
+			time.Sleep(visibilityPoll)
+		}
+	}
+}
+
+// getVisibilityMessage reports the delays until uploaded objects
+// were visible, in read-after-write mode.
+func (tr *TestResult) getVisibilityMessage() string {
+	if mode != modeReadAfterWrite || len(tr.visibilityDelays) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Read-after-write visibility delay: %v\n%v of %v objects were visible on the first read.\n",
+		getPercentilesMessage(sortDurations(tr.visibilityDelays)),
+		tr.visibleFirstRead, len(tr.visibilityDelays))
+}
+
+// overwriteDurations returns the sorted latencies of the uploads that
+// created a new object and of those that overwrote an existing one,
+// with -overwrite-ratio.
+func (tr *TestResult) overwriteDurations() (creates, overwrites []time.Duration) {
+	creates = tr.sortedDurationsFunc(func(sample opSample) bool {
+		return sample.opType == opPut && !sample.overwrite
+	})
+	overwrites = tr.sortedDurationsFunc(func(sample opSample) bool {
+		return sample.opType == opPut && sample.overwrite
+	})
+	return creates, overwrites
+}
+
+// getOverwriteMessage reports the latencies of creating and
+// overwriting objects separately, with -overwrite-ratio.
+func (tr *TestResult) getOverwriteMessage() string {
+	if overwriteRatio == 0 {
+		return ""
+	}
+	creates, overwrites := tr.overwriteDurations()
+	msg := fmt.Sprintf("Uploads: %v creates, %v overwrites\n",
+		tr.opCounts[opPut]-tr.overwriteCount, tr.overwriteCount)
+	if len(creates) > 0 {
+		msg += fmt.Sprintf("Create latency: %v\n", getPercentilesMessage(creates))
+	}
+	if len(overwrites) > 0 {
+		msg += fmt.Sprintf("Overwrite latency: %v\n", getPercentilesMessage(overwrites))
+	}
+	return msg
+}
+
+// getRestoreMessage reports the latencies of initiating restores, in
+// restore mode, separately from the latencies until the restored
+// objects were readable.
+func (tr *TestResult) getRestoreMessage() string {
+	if mode != modeRestore || len(tr.restoreInits) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Restore initiation latency: %v\nRestore completion latency: %v\n",
+		getPercentilesMessage(sortDurations(tr.restoreInits)),
+		getPercentilesMessage(tr.sortedDurations(opRestore)))
+}
+
+// select formats
+const (
+	// CSV with a header line
+	selectCSV = "csv"
+
+	// JSON lines
+	selectJSON = "json"
+)
+
+// selectRecord returns the i-th record of the -select-format, with
+// an id, a name and a value from 0 to 999, or the CSV header line for
+// i = -1.
+func selectRecord(i int) string {
+	if selectFormat == selectCSV {
+		if i < 0 {
+			return "id,name,value\n"
+		}
+		return fmt.Sprintf("%d,name-%d,%d\n", i, i, i*7919%1000)
+	}
+	return fmt.Sprintf("{\"id\":%d,\"name\":\"name-%d\",\"value\":%d}\n", i, i, i*7919%1000)
+}
+
+// firstSelectRecord is the index of the first line of the objects of
+// the -select-format, -1 for the CSV header.
+func firstSelectRecord() int {
+	if selectFormat == selectCSV {
+		return -1
+	}
+	return 0
+}
+
+// minSelectSize returns the size of the smallest object of the
+// -select-format with a record: its header and first record.
+func minSelectSize() int64 {
+	n := int64(len(selectRecord(0)))
+	if selectFormat == selectCSV {
+		n += int64(len(selectRecord(-1)))
+	}
+	return n
+}
+
+// selectData streams the whole records of the -select-format that
+// fit in at most size bytes, for objects queried in select mode. The
+// records are generated while reading, so that large objects are not
+// held in memory.
+type selectData struct {
+	// length of the whole records.
+	size int64
+
+	// read position, index of the next record and the unread rest
+	// of the current one.
+	pos  int64
+	next int
+	rest string
+}
+
+// newSelectData returns the records of an object of at most size
+// bytes. It fails if not even the header and the first record fit.
+func newSelectData(size int64) (*selectData, error) {
+	if size < minSelectSize() {
+		return nil, fmt.Errorf("object size %v is smaller than the %v bytes of the header and a record", size, minSelectSize())
+	}
+	sd := &selectData{next: firstSelectRecord()}
+	for i := firstSelectRecord(); ; i++ {
+		n := int64(len(selectRecord(i)))
+		if sd.size+n > size {
+			return sd, nil
+		}
+		sd.size += n
+	}
+}
+
+func (sd *selectData) Read(p []byte) (int, error) {
+	if sd.pos >= sd.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && sd.pos < sd.size {
+		if sd.rest == "" {
+			sd.rest = selectRecord(sd.next)
+			sd.next++
+		}
+		c := copy(p[n:], sd.rest)
+		sd.rest = sd.rest[c:]
+		sd.pos += int64(c)
+		n += c
+	}
+	return n, nil
+}
+
+// Seek regenerates the records up to the new position, from the start
+// if it is before the current one.
+func (sd *selectData) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += sd.pos
+	case io.SeekEnd:
+		offset += sd.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset < sd.pos {
+		sd.pos, sd.next, sd.rest = 0, firstSelectRecord(), ""
+	}
+	for sd.pos < offset && sd.pos < sd.size {
+		if sd.rest == "" {
+			sd.rest = selectRecord(sd.next)
+			sd.next++
+		}
+		skip := int64(len(sd.rest))
+		if sd.pos+skip > offset {
+			skip = offset - sd.pos
+		}
+		sd.rest = sd.rest[skip:]
+		sd.pos += skip
+	}
+	sd.pos = offset
+	return offset, nil
+}
+
+// selectStats is the number of bytes scanned, processed and returned
+// by S3 Select queries.
+type selectStats struct {
+	scanned   int64
+	processed int64
+	returned  int64
+}
+
+func (ss *selectStats) merge(other selectStats) {
+	ss.scanned += other.scanned
+	ss.processed += other.processed
+	ss.returned += other.returned
+}
+
+// selectObject queries the object with the -select-query, reads all
+// returned records, and returns the statistics of the query. If the
+// server sends no statistics, the returned bytes are those of the
+// records.
+func selectObject(s3Client *s3.S3, key string) (selectStats, error) {
+	input := &s3.SelectObjectContentInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		Expression:          aws.String(selectQuery),
+		ExpressionType:      aws.String(s3.ExpressionTypeSql),
+		InputSerialization:  &s3.InputSerialization{},
+		OutputSerialization: &s3.OutputSerialization{},
+	}
+	if selectFormat == selectCSV {
+		input.InputSerialization.CSV = &s3.CSVInput{FileHeaderInfo: aws.String(s3.FileHeaderInfoUse)}
+		input.OutputSerialization.CSV = &s3.CSVOutput{}
+	} else {
+		input.InputSerialization.JSON = &s3.JSONInput{Type: aws.String(s3.JSONTypeLines)}
+		input.OutputSerialization.JSON = &s3.JSONOutput{}
+	}
+	out, err := s3Client.SelectObjectContent(input)
+	if err != nil {
+		return selectStats{}, err
+	}
+	defer out.EventStream.Close()
+
+	var stats selectStats
+	var recordBytes int64
+	var gotStats, ended bool
+	for event := range out.EventStream.Events() {
+		switch e := event.(type) {
+		case *s3.RecordsEvent:
+			recordBytes += int64(len(e.Payload))
+		case *s3.StatsEvent:
+			if e.Details != nil {
+				gotStats = true
+				stats.scanned = aws.Int64Value(e.Details.BytesScanned)
+				stats.processed = aws.Int64Value(e.Details.BytesProcessed)
+				stats.returned = aws.Int64Value(e.Details.BytesReturned)
+			}
+		case *s3.EndEvent:
+			ended = true
+		}
+	}
+	if err := out.EventStream.Err(); err != nil {
+		return selectStats{}, err
+	}
+	if !ended {
+		return selectStats{}, errors.New("the query results ended without an end event")
+	}
+	if !gotStats {
+		stats.returned = recordBytes
+	}
+	return stats, nil
+}
+
+// checkSelectSupport checks that the server supports S3 Select, with
+// one of the live objects.
+func checkSelectSupport(s3Client *s3.S3) error {
+	key, ok := liveKeys.random(rand.New(rand.NewSource(randomSeed)))
+	if !ok {
+		return errors.New("no objects to query")
+	}
+	_, err := selectObject(s3Client, key)
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.StatusCode() == http.StatusNotImplemented,
+			reqErr.StatusCode() == http.StatusMethodNotAllowed,
+			reqErr.Code() == "NotImplemented",
+			reqErr.Code() == "XNotImplemented":
+			return fmt.Errorf("SelectObjectContent is unsupported by the server - %w", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("SelectObjectContent Error for bucket %v and key %v - %w", bucket, key, err)
+	}
+	return nil
+}
+
+// getSelectMessage reports the bytes scanned and returned by the
+// queries in select mode.
+func (tr *TestResult) getSelectMessage() string {
+	if mode != modeSelect || tr.objectCount == 0 {
+		return ""
+	}
+	msg := fmt.Sprintf("S3 Select: %v bytes scanned, %v processed and %v returned by %v queries",
+		tr.selectStats.scanned, tr.selectStats.processed, tr.selectStats.returned, tr.objectCount)
+	if tr.selectStats.scanned > 0 {
+		msg += fmt.Sprintf(" (%.2f%% of the scanned bytes returned)",
+			float64(tr.selectStats.returned)*100/float64(tr.selectStats.scanned))
+	}
+	return msg + ".\n"
+}
+
+// checkObjectAttributes checks that the server supports
+// GetObjectAttributes, with one of the live objects.
+func checkObjectAttributes(s3Client *s3.S3) error {
+	key, ok := targetKey, true
+	if targetKey == "" {
+		key, ok = liveKeys.random(rand.New(rand.NewSource(randomSeed)))
+	}
+	if !ok {
+		return errors.New("no objects to retrieve the attributes of")
+	}
+	_, err := getObjectAttributes(s3Client, bucket, key)
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.StatusCode() == http.StatusNotImplemented,
+			reqErr.StatusCode() == http.StatusMethodNotAllowed,
+			reqErr.Code() == "NotImplemented",
+			reqErr.Code() == "XNotImplemented":
+			return fmt.Errorf("GetObjectAttributes is unsupported by the server - %w", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("GetObjectAttributes Error for bucket %v and key %v - %w", bucket, key, err)
+	}
+	return nil
+}
+
+// conflictCode returns the error code of err if it is a response to
+// concurrent writes of one key: a conflict, or throttling of the
+// writes.
+func conflictCode(err error) (string, bool) {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return "", false
+	}
+	switch reqErr.StatusCode() {
+	case http.StatusConflict, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return reqErr.Code(), true
+	}
+	return "", false
+}
+
+// isNotFound returns whether err is a response to a request for an
+// object that does not exist.
+func isNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound &&
+		reqErr.Code() != s3.ErrCodeNoSuchBucket
+}
+
+func deleteObject(s3Client *s3.S3, bucket, key string) error {
+	_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// pickObjectSize returns the size of the next object to upload - size,
+// or a size picked with r if a range of sizes is given.
+func pickObjectSize(r *rand.Rand, size int64) int64 {
+	if objSizeRange.max > objSizeRange.min {
+		return objSizeRange.pick(r)
+	}
+	return size
+}
+
+// prepopulate uploads count objects of the given size with
+// concurrency parallel uploads and adds them to the live objects. With
+// -buckets, the objects are spread evenly over the buckets. It returns
+// the number of distinct keys written to each bucket.
+func prepopulate(count int, objSize int64) ([]int, error) {
+	session, err := getAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	s3Client := s3.New(session)
+
+	var prog *progress
+	if len(buckets) > 1 {
+		prog = startPartsProgress("Prepopulating buckets", int64(count), buckets)
+	} else {
+		prog = startProgress("Prepopulating bucket", int64(count))
+	}
+	defer prog.finish()
+
+	// an object to upload, and the index of its bucket.
+	type bucketObject struct {
+		object ObjGen
+		bucket int
+	}
+	objCh := make(chan bucketObject)
+	errCh := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bo := range objCh {
+				object, bucket := bo.object, buckets[bo.bucket]
+				var body io.ReadSeeker = &object
+				if mode == modeSelect {
+					// records for the queries to scan.
+					sd, err := newSelectData(object.ObjectSize)
+					if err != nil {
+						errCh <- err
+						return
+					}
+					body = sd
+				}
+				_, err := s3Client.PutObject(&s3.PutObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    aws.String(object.ObjectName),
+					Body:   body,
+				})
+				if err != nil {
+					errCh <- fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+					return
+				}
+				bucketKeys[bo.bucket].add(object.ObjectName)
+				prog.addPart(bo.bucket, 1)
+			}
+		}()
+	}
+
+	// separate from the random sources of the workers, which are
+	// seeded with randomSeed plus the worker id.
+	prepRand := rand.New(rand.NewSource(randomSeed - 1))
+
+	// the objects are named from distinct generated names, drawn in
+	// a random order without replacement, and once all are drawn,
+	// from any of them. In delete mode, where each object must be
+	// deleted once, count unique names are generated instead.
+	var deleteNames []string
+	if mode == modeDelete && objKeyTemplate == nil {
+		if deleteNames, err = newUniqueNames(count); err != nil {
+			return nil, err
+		}
+	}
+	order := prepRand.Perm(len(randObjNames))
+	drawn := make(map[string]bool)
+	nextName := func() string {
+		if deleteNames != nil {
+			name := deleteNames[0]
+			deleteNames = deleteNames[1:]
+			return name
+		}
+		for len(order) > 0 {
+			i := order[0]
+			order = order[1:]
+			if name := randObjNames[i]; !drawn[name] {
+				drawn[name] = true
+				if keyUsed != nil {
+					atomic.StoreInt32(&keyUsed[i], 1)
+				}
+				return name
+			}
+		}
+		return pickObjectName(prepRand)
+	}
+
+	// the distinct keys written to each bucket.
+	keys := make([]map[string]bool, len(buckets))
+	for i := range keys {
+		keys[i] = make(map[string]bool)
+	}
+	for i := 0; i < count && err == nil; i++ {
+		seedBytes := []byte(getAlNumPerm(prepRand))
+		size := pickObjectSize(prepRand, objSize)
+		var name string
+		if objKeyTemplate != nil {
+			name = objKeyTemplate.expand("prepopulate", prepRand)
+		} else {
+			name = nextName()
+		}
+		var object ObjGen
+		if object, err = newNamedObject(seedBytes, size, name); err != nil {
+			break
+		}
+		bucket := i % len(buckets)
+		select {
+		case objCh <- bucketObject{object, bucket}:
+			keys[bucket][object.ObjectName] = true
+		case err = <-errCh:
+		}
+	}
+	close(objCh)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errCh:
+		default:
+		}
+	}
+	written := make([]int, len(buckets))
+	for i := range keys {
+		written[i] = len(keys[i])
+	}
+	return written, err
+}
+
+// removeAllObjects removes all objects in the bucket and returns the
+// number of objects removed. Unless force is set, the user is asked
+// to confirm first.
+func removeAllObjects(s3Client *s3.S3) (int, error) {
+	var keys []*string
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if !force {
+		if !isTerminal(os.Stdin) {
+			return 0, errors.New("-empty-bucket requires -force when stdin is not a terminal")
+		}
+		fmt.Printf("Remove all %v objects in bucket %v? [y/N] ", len(keys), bucket)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return 0, errors.New("emptying the bucket was not confirmed")
+		}
+	}
+
+	prog := startProgress("Emptying bucket", int64(len(keys)))
+	defer prog.finish()
+	removed := 0
+	// DeleteObjects takes up to 1000 keys per request.
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+		ids := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			ids = append(ids, &s3.ObjectIdentifier{Key: key})
+		}
+		out, err := s3Client.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return removed, err
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return removed + len(ids) - len(out.Errors), fmt.Errorf("removing %v failed - %v: %v",
+				aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+		removed += len(ids)
+		prog.add(int64(len(ids)))
+	}
+	return removed, nil
+}
+
+// sizeRange is a range of object sizes to pick from uniformly at
+// random.
+type sizeRange struct {
+	min, max int64
+}
+
+// parseSizeRange parses a size, or a range of sizes given as
+// "MIN-MAX", e.g. "1KiB-1MiB".
+func parseSizeRange(spec string) (sr sizeRange, err error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if sr.min, err = parseHumanNumber(parts[0]); err != nil {
+		return sr, err
+	}
+	sr.max = sr.min
+	if len(parts) == 2 {
+		if sr.max, err = parseHumanNumber(parts[1]); err != nil {
+			return sr, err
+		}
+	}
+	if sr.min < 0 || sr.max < sr.min {
+		return sr, fmt.Errorf("invalid size range %q", spec)
+	}
+	return sr, nil
+}
+
+// pick returns a random size in the range.
+func (sr sizeRange) pick(r *rand.Rand) int64 {
+	if sr.max == sr.min {
+		return sr.min
+	}
+	return sr.min + r.Int63n(sr.max-sr.min+1)
+}
+
+// durationRange is a range of durations to pick from uniformly at
+// random.
+type durationRange struct {
+	min, max time.Duration
+}
+
+// parseDurationRange parses a duration, or a range of durations
+// given as "MIN-MAX", e.g. "100ms-500ms".
+func parseDurationRange(spec string) (dr durationRange, err error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if dr.min, err = time.ParseDuration(parts[0]); err != nil {
+		return dr, err
+	}
+	dr.max = dr.min
+	if len(parts) == 2 {
+		if dr.max, err = time.ParseDuration(parts[1]); err != nil {
+			return dr, err
+		}
+	}
+	if dr.min < 0 || dr.max < dr.min {
+		return dr, fmt.Errorf("invalid duration range %q", spec)
+	}
+	return dr, nil
+}
+
+// pick returns a random duration in the range.
+func (dr durationRange) pick(r *rand.Rand) time.Duration {
+	if dr.max == dr.min {
+		return dr.min
+	}
+	return dr.min + time.Duration(r.Int63n(int64(dr.max-dr.min)+1))
+}
+
+// total think time of all workers, updated atomically.
+var thinkTimeTotal int64
+
+// pauser lets the load be paused and resumed while a test runs.
+type pauser struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	paused   bool
+	pausedAt time.Time
+
+	// total time spent paused, excluding a current pause.
+	pausedTotal time.Duration
+}
+
+func newPauser() *pauser {
+	p := &pauser{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// toggle pauses the load if it is running and resumes it if it is
+// paused. Returns the new state and the time of the change.
+func (p *pauser) toggle() (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().UTC()
+	if p.paused {
+		p.pausedTotal += now.Sub(p.pausedAt)
+		p.cond.Broadcast()
+	} else {
+		p.pausedAt = now
+	}
+	p.paused = !p.paused
+	return p.paused, now
+}
+
+// wait blocks while the load is paused.
+func (p *pauser) wait() {
+	p.mu.Lock()
+	for p.paused {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+}
+
+// isPaused returns whether the load is paused.
+func (p *pauser) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// totalPaused returns the total time spent paused so far.
+func (p *pauser) totalPaused() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return p.pausedTotal + time.Since(p.pausedAt)
+	}
+	return p.pausedTotal
+}
+
+// adaptiveLimiter limits the number of operations in flight to a
+// window, which an AIMD controller adapts to the throttling responses
+// of the server: each second, the window is halved if more than
+// adaptiveThreshold of the responses were throttling responses, and
+// grows by one otherwise, up to the concurrency.
+type adaptiveLimiter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	window   int
+	inFlight int
+
+	// responses, and throttling responses, since the last
+	// adjustment - updated atomically.
+	responses int64
+	throttled int64
+
+	// number of decreases of the window, its minimum, and its value
+	// in each second of the test.
+	decreases    int
+	minWindow    int
+	secondWindow []int
+}
+
+// operations in flight, with -adaptive - nil if disabled.
+var limiter *adaptiveLimiter
+
+func newAdaptiveLimiter(window int) *adaptiveLimiter {
+	al := &adaptiveLimiter{window: window, minWindow: window}
+	al.cond = sync.NewCond(&al.mu)
+	return al
+}
+
+// acquire blocks until an operation may start.
+func (al *adaptiveLimiter) acquire() {
+	al.mu.Lock()
+	for al.inFlight >= al.window {
+		al.cond.Wait()
+	}
+	al.inFlight++
+	al.mu.Unlock()
+}
+
+// release ends an operation started after acquire.
+func (al *adaptiveLimiter) release() {
+	al.mu.Lock()
+	al.inFlight--
+	al.cond.Signal()
+	al.mu.Unlock()
+}
+
+// observe counts a response of the server.
+func (al *adaptiveLimiter) observe(statusCode int) {
+	atomic.AddInt64(&al.responses, 1)
+	if statusCode == http.StatusServiceUnavailable || statusCode == http.StatusTooManyRequests {
+		atomic.AddInt64(&al.throttled, 1)
+	}
+}
+
+// adjust adapts the window to the responses since the last
+// adjustment, and records it as the window of the second.
+func (al *adaptiveLimiter) adjust() {
+	responses := atomic.SwapInt64(&al.responses, 0)
+	throttled := atomic.SwapInt64(&al.throttled, 0)
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	switch {
+	case responses > 0 && float64(throttled)/float64(responses) > adaptiveThreshold:
+		if al.window > 1 {
+			al.window /= 2
+			al.decreases++
+		}
+		if al.window < al.minWindow {
+			al.minWindow = al.window
+		}
+	case al.window < concurrency:
+		al.window++
+		al.cond.Broadcast()
+	}
+	al.secondWindow = append(al.secondWindow, al.window)
+}
+
+// run adjusts the window each second until stopCh is closed.
+func (al *adaptiveLimiter) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			al.adjust()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// throttleCountingTransport counts the responses of the server and
+// its throttling responses in limiter.
+type throttleCountingTransport struct {
+	next http.RoundTripper
+}
+
+func (tt *throttleCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := tt.next.RoundTrip(req)
+	if err == nil {
+		limiter.observe(resp.StatusCode)
+	}
+	return resp, err
+}
+
+// tokenBucket limits the operations of all workers to a rate, with
+// -rate. A waiting operation reserves its token, so that the tokens
+// go to the workers in the order in which they asked for them.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// operations per second, with -rate - nil if disabled.
+var rateBucket *tokenBucket
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: 1, last: time.Now()}
+}
+
+// wait blocks until an operation may start.
+func (tb *tokenBucket) wait() {
+	tb.mu.Lock()
+	now := time.Now()
+	tb.tokens = math.Min(1, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	tb.tokens--
+	delay := time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	tb.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// parseRateOps parses the comma separated operation types of the
+// mixed mode to which -rate applies.
+func parseRateOps(spec string) (map[string]bool, error) {
+	ops := make(map[string]bool)
+	for _, opType := range strings.Split(spec, ",") {
+		opType = strings.TrimSpace(opType)
+		switch opType {
+		case opPut, opGet, opDelete, opStat:
+		default:
+			return nil, fmt.Errorf("unknown operation %q", opType)
+		}
+		if workload.weightOf(opType) == 0 {
+			return nil, fmt.Errorf("operation %q is not in the -workload", opType)
+		}
+		ops[opType] = true
+	}
+	return ops, nil
+}
+
+// adaptiveSummary summarizes the window of operations in flight,
+// with -adaptive.
+type adaptiveSummary struct {
+	Decreases    int   `json:"decreases"`
+	MinWindow    int   `json:"minWindow"`
+	FinalWindow  int   `json:"finalWindow"`
+	SecondWindow []int `json:"secondWindow"`
+}
+
+// getAdaptiveMessage reports how the window of operations in flight
+// was adapted, with -adaptive.
+func (tr *TestResult) getAdaptiveMessage() string {
+	if limiter == nil {
+		return ""
+	}
+	return fmt.Sprintf("Adaptive window: decreased %v times, to at least %v - %v of %v operations in flight at the end.\n",
+		tr.adaptive.Decreases, tr.adaptive.MinWindow, tr.adaptive.FinalWindow, concurrency)
+}
+
+// the interval and size of the uploads of the -healthcheck probe.
+const (
+	healthcheckInterval = time.Second
+	healthcheckSize     = 1024
+)
+
+// healthcheckSample is the result of an upload of the health-check
+// probe.
+type healthcheckSample struct {
+	start    time.Time
+	duration time.Duration
+	err      error
+}
+
+// healthchecker uploads a small object to a fixed key each
+// healthcheckInterval, one upload at a time, to measure how
+// responsive the server is apart from the load of the workers.
+type healthchecker struct {
+	s3Client *s3.S3
+	key      string
+	content  []byte
+	samples  []healthcheckSample
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// getHealthcheckSession returns a session for the first endpoint for
+// the health-check probe. It has its own HTTP client, without the
+// connection counting, throttle counting and fault injection of the
+// workers, and none of their handlers, so that its uploads do not
+// count towards the retries, faults and connections of the test. It
+// does not retry, so that each probe is a single upload.
+func getHealthcheckSession() (*session.Session, error) {
+	ep := endpoints[0]
+	sess, err := session.NewSessionWithOptions(
+		session.Options{
+			Config: aws.Config{
+				Endpoint: aws.String(ep.host),
+				Region:   aws.String("us-east-1"),
+				Credentials: credentials.NewStaticCredentials(
+					accessKey, secretKey, ""),
+				DisableSSL:       aws.Bool(!ep.secure),
+				S3ForcePathStyle: aws.Bool(true),
+				HTTPClient:       &http.Client{Transport: newTransport(), Timeout: opTimeout},
+				MaxRetries:       aws.Int(0)},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler("minio-perftest-run/" + runID))
+	return sess, nil
+}
+
+func startHealthchecker() (*healthchecker, error) {
+	session, err := getHealthcheckSession()
+	if err != nil {
+		return nil, err
+	}
+	hc := &healthchecker{
+		s3Client: s3.New(session),
+		key:      "minio-perftest-healthcheck-" + runID,
+		content:  make([]byte, healthcheckSize),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go hc.run()
+	return hc, nil
+}
+
+func (hc *healthchecker) run() {
+	defer close(hc.doneCh)
+	ticker := time.NewTicker(healthcheckInterval)
+	defer ticker.Stop()
+	for {
+		hc.probe()
+		select {
+		case <-ticker.C:
+		case <-hc.stopCh:
+			return
+		}
+	}
+}
+
+func (hc *healthchecker) probe() {
+	start := time.Now().UTC()
+	_, err := hc.s3Client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(hc.key),
+		Body:   bytes.NewReader(hc.content),
+	})
+	hc.samples = append(hc.samples, healthcheckSample{start, time.Since(start), err})
+}
+
+// stop waits for the upload in progress, deletes the object of the
+// probe and returns its results.
+func (hc *healthchecker) stop() []healthcheckSample {
+	close(hc.stopCh)
+	<-hc.doneCh
+	if err := deleteObject(hc.s3Client, bucket, hc.key); err != nil {
+		fmt.Printf("Deleting health-check object %v failed - %v\n", hc.key, err)
+	}
+	return hc.samples
+}
+
+// healthcheckSummary summarizes the uploads of the health-check
+// probe, with -healthcheck.
+type healthcheckSummary struct {
+	Latency latencySummary `json:"latency"`
+	Failed  int            `json:"failed"`
+}
+
+// healthcheckLatencies returns the sorted latencies of the
+// successful uploads of the health-check probe, and the number of
+// failed ones.
+func (tr *TestResult) healthcheckLatencies() ([]time.Duration, int) {
+	var latencies []time.Duration
+	failed := 0
+	for _, hs := range tr.healthchecks {
+		if hs.err != nil {
+			failed++
+			continue
+		}
+		latencies = append(latencies, hs.duration)
+	}
+	return sortDurations(latencies), failed
+}
+
+// secondHealthcheck returns the latency of the health-check upload
+// started in each second of the test, or zero if none succeeded.
+func (tr *TestResult) secondHealthcheck(seconds int) []time.Duration {
+	latencies := make([]time.Duration, seconds)
+	for _, hs := range tr.healthchecks {
+		sec := int(hs.start.Sub(tr.startTime) / time.Second)
+		if hs.err == nil && sec >= 0 && sec < seconds {
+			latencies[sec] = hs.duration
+		}
+	}
+	return latencies
+}
+
+// getHealthcheckMessage reports the latencies of the health-check
+// probe, with -healthcheck.
+func (tr *TestResult) getHealthcheckMessage() string {
+	if !healthcheck || len(tr.healthchecks) == 0 {
+		return ""
+	}
+	latencies, failed := tr.healthcheckLatencies()
+	msg := fmt.Sprintf("Health-check latency (%v uploads, %v failed)", len(tr.healthchecks), failed)
+	if len(latencies) > 0 {
+		msg += ": " + getPercentilesMessage(latencies)
+	}
+	return msg + "\n"
+}
+
+// writeHangDump writes the stacks of all goroutines to a file named
+// after the run and the number of the dump, and returns its name.
+func writeHangDump(n int) (string, error) {
+	buf := make([]byte, 1024*1024)
+	for {
+		size := runtime.Stack(buf, true)
+		if size < len(buf) {
+			buf = buf[:size]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	fileName := fmt.Sprintf("minio-perftest-hang-%v-%v.txt", runID, n)
+	return fileName, writeFile(fileName, func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+}
+
+var (
+	errWorkerSucc = errors.New("Worker is exiting with success.")
+	errWorkerQuit = errors.New("Worker is quitting due to quit signal.")
+)
+
+type workerMsg struct {
+	// If exitingErr != nil -> worker is quitting with an error
+	// value.
+	exitingErr error
+
+	// error of an operation the worker carries on after, with
+	// -max-consecutive-errors.
+	opErr error
+
+	// time until the operation failed with opErr.
+	errDuration time.Duration
+
+	// type of the operation.
+	opType string
+
+	// Sends time at which putobject was successful
+	putStartTime time.Time
+	putDuration  time.Duration
+
+	// time taken to presign the URL of a download in presigned-get
+	// mode, and to compute the checksum of an upload with
+	// -checksum, which are not part of putDuration.
+	signDuration     time.Duration
+	checksumDuration time.Duration
+
+	// time spent generating the content of an upload, with
+	// -measure-generation, which is part of putDuration.
+	genDuration time.Duration
+
+	// set if the upload was a multipart upload that was
+	// deliberately left incomplete.
+	abandoned bool
+
+	// set if the upload replaced an existing object, with
+	// -overwrite-ratio.
+	overwrite bool
+
+	// set if the operation was skipped as another worker deleted
+	// its object, in mixed mode.
+	skipped bool
+
+	// latencies of the steps of a multipart upload, with
+	// -manual-multipart.
+	multipart *multipartTiming
+
+	// error code of a conflict response to an upload of the
+	// hotspot key, which does not end the test.
+	conflictCode string
+
+	// key prefix of the uploaded object, with -size-prefix.
+	prefix string
+
+	// in versions mode, the sequence number of the version of the
+	// key (starting at 1), and its version id.
+	versionSeq int
+	versionID  string
+
+	// trace id of the operation, with -exemplars.
+	traceID string
+
+	// processing time reported by the server in Server-Timing
+	// headers of the operation's responses, if any.
+	serverTime  time.Duration
+	serverTimed bool
+
+	// index of the endpoint the operation was sent to.
+	endpoint int
+
+	// time taken to initiate a restore, in restore mode - the
+	// latency of the operation lasts until the object is readable.
+	restoreInit time.Duration
+
+	// time from the end of an upload until the object was visible,
+	// and the number of reads until then, in read-after-write mode.
+	visibilityDelay time.Duration
+	visibilityReads int
+
+	// bytes scanned and returned by a query in select mode.
+	selectStats selectStats
+
+	// number of incomplete uploads returned by a list operation.
+	listedCount int64
+
+	// size of the uploaded or downloaded object.
+	objectSize int64
+
+	// name and seed bytes of the uploaded object - only set if the
+	// manifest is recorded.
+	objectName string
+	seedBytes  []byte
+
+	// results collected by the worker since its last flush.
+	stats *workerStats
+}
+
+// workerStats aggregates the results of a worker's operations
+// between flushes to the collector, so that the collector does not
+// need to process a message for every operation.
+type workerStats struct {
+	// id of the worker.
+	workerID int
+
+	opCount          int64
+	bytesWritten     int64
+	bytesRead        int64
+	totalDuration    time.Duration
+	signDuration     time.Duration
+	checksumDuration time.Duration
+	abandonedCount   int64
+	skippedCount     int64
+	listedCount      int64
+
+	// number of successful uploads that overwrote an existing
+	// object, with -overwrite-ratio.
+	overwriteCount int64
+
+	// time spent generating the content of uploads, and their
+	// total duration, with -measure-generation.
+	genDuration       time.Duration
+	genUploadDuration time.Duration
+
+	// start of the worker's first operation, and the time it quit,
+	// with -record-concurrency - zero if not in these results.
+	activeStart time.Time
+	activeEnd   time.Time
+
+	// totals of the operations sent to each endpoint.
+	endpointStats []endpointStats
+
+	// server processing times of the operations with Server-Timing
+	// headers.
+	serverTiming serverTiming
+
+	// number and latency of the operations completed in each
+	// second of the test, keyed by the seconds since the test start.
+	secondCount   map[int64]int64
+	secondLatency map[int64]secondLatency
+
+	// number of successful operations of each type.
+	opCounts map[string]int64
+
+	// number of conflict responses, keyed by error code.
+	conflicts map[string]int64
+
+	// uploaded objects by key prefix, with -size-prefix.
+	prefixes map[string]*prefixStats
+
+	// latencies of the steps of multipart uploads, with
+	// -manual-multipart.
+	multipart multipartLatencies
+
+	// latencies of initiating restores, in restore mode.
+	restoreInits []time.Duration
+
+	// delays until uploaded objects were visible, and the number
+	// visible on the first read, in read-after-write mode.
+	visibilityDelays []time.Duration
+	visibleFirstRead int64
+
+	// bytes scanned and returned by the queries in select mode.
+	selectStats selectStats
+
+	// sample of each successful operation.
+	samples []opSample
+
+	// failed operations, with -parquet and -sqlite.
+	failed []opSample
+
+	// uploaded objects, if the manifest is recorded.
+	uploaded []manifestEntry
+}
+
+// opSample records a successful operation.
+type opSample struct {
+	opType    string
+	startTime time.Time
+	duration  time.Duration
+
+	// size of the uploaded or downloaded object.
+	size int64
+
+	// sequence number of the uploaded version, in versions mode.
+	versionSeq int
+
+	// set if the upload replaced an existing object.
+	overwrite bool
+
+	// time spent generating the content of the upload, with
+	// -measure-generation.
+	genDuration time.Duration
+
+	// id of the worker that ran the operation, and index of the
+	// endpoint it was sent to.
+	workerID int
+	endpoint int
+}
+
+func newWorkerStats(workerID int) *workerStats {
+	return &workerStats{
+		workerID:      workerID,
+		endpointStats: make([]endpointStats, len(endpoints)),
+		secondCount:   make(map[int64]int64),
+		secondLatency: make(map[int64]secondLatency),
+		opCounts:      make(map[string]int64),
+		conflicts:     make(map[string]int64),
+		prefixes:      make(map[string]*prefixStats),
+	}
+}
+
+// add records a successful operation.
+func (ws *workerStats) add(msg workerMsg, testStart time.Time) {
+	if msg.multipart != nil {
+		// abandoned uploads count towards the create and part
+		// latencies.
+		ws.multipart.add(msg.multipart)
+	}
+	if msg.abandoned {
+		ws.abandonedCount++
+		return
+	}
+	if msg.skipped {
+		ws.skippedCount++
+		return
+	}
+	if msg.conflictCode != "" {
+		ws.conflicts[msg.conflictCode]++
+		return
+	}
+	ws.opCount++
+	ws.opCounts[msg.opType]++
+	if sizePrefixes != nil && msg.opType == opPut {
+		ps := ws.prefixes[msg.prefix]
+		if ps == nil {
+			ps = &prefixStats{}
+			ws.prefixes[msg.prefix] = ps
+		}
+		ps.add(msg.objectSize)
+	}
+	switch msg.opType {
+	case opGet:
+		ws.bytesRead += msg.objectSize
+	case opStat:
+		// only the metadata of the object is read.
+	default:
+		ws.bytesWritten += msg.objectSize
+	}
+	ws.totalDuration += msg.putDuration
+	ws.endpointStats[msg.endpoint].add(msg)
+	ws.signDuration += msg.signDuration
+	ws.checksumDuration += msg.checksumDuration
+	ws.listedCount += msg.listedCount
+	if msg.overwrite {
+		ws.overwriteCount++
+	}
+	if measureGeneration && msg.opType == opPut {
+		ws.genDuration += msg.genDuration
+		ws.genUploadDuration += msg.putDuration
+	}
+	if msg.opType == opRestore {
+		ws.restoreInits = append(ws.restoreInits, msg.restoreInit)
+	}
+	ws.selectStats.merge(msg.selectStats)
+	if msg.visibilityReads > 0 {
+		ws.visibilityDelays = append(ws.visibilityDelays, msg.visibilityDelay)
+		if msg.visibilityReads == 1 {
+			ws.visibleFirstRead++
+		}
+	}
+	if msg.serverTimed {
+		ws.serverTiming.merge(serverTiming{ops: 1, serverTime: msg.serverTime, latency: msg.putDuration})
+	}
+	endTime := msg.putStartTime.Add(msg.putDuration)
+	sec := int64(endTime.Sub(testStart) / time.Second)
+	ws.secondCount[sec]++
+	sl := ws.secondLatency[sec]
+	sl.merge(secondLatency{total: msg.putDuration, max: msg.putDuration})
+	ws.secondLatency[sec] = sl
+	ws.samples = append(ws.samples, opSample{
+		opType:      msg.opType,
+		startTime:   msg.putStartTime,
+		duration:    msg.putDuration,
+		size:        msg.objectSize,
+		versionSeq:  msg.versionSeq,
+		overwrite:   msg.overwrite,
+		genDuration: msg.genDuration,
+		workerID:    ws.workerID,
+		endpoint:    msg.endpoint,
+	})
+	if msg.objectName != "" {
+		ws.uploaded = append(ws.uploaded, manifestEntry{
+			Key:       msg.objectName,
+			VersionID: msg.versionID,
+			Size:      msg.objectSize,
+			seedBytes: msg.seedBytes,
+			endTime:   endTime,
+		})
+	}
+}
+
+// merge adds the results in other, which must be from the same
+// worker.
+func (ws *workerStats) merge(other *workerStats) {
+	ws.opCount += other.opCount
+	ws.bytesWritten += other.bytesWritten
+	ws.bytesRead += other.bytesRead
+	ws.totalDuration += other.totalDuration
+	ws.signDuration += other.signDuration
+	ws.checksumDuration += other.checksumDuration
+	ws.abandonedCount += other.abandonedCount
+	ws.skippedCount += other.skippedCount
+	ws.listedCount += other.listedCount
+	ws.overwriteCount += other.overwriteCount
+	ws.genDuration += other.genDuration
+	ws.genUploadDuration += other.genUploadDuration
+	if ws.activeStart.IsZero() {
+		ws.activeStart = other.activeStart
+	}
+	if !other.activeEnd.IsZero() {
+		ws.activeEnd = other.activeEnd
+	}
+	ws.serverTiming.merge(other.serverTiming)
+	for i := range other.endpointStats {
+		ws.endpointStats[i].merge(other.endpointStats[i])
+	}
+	for sec, count := range other.secondCount {
+		ws.secondCount[sec] += count
+		sl := ws.secondLatency[sec]
+		sl.merge(other.secondLatency[sec])
+		ws.secondLatency[sec] = sl
+	}
+	for opType, count := range other.opCounts {
+		ws.opCounts[opType] += count
+	}
+	for code, count := range other.conflicts {
+		ws.conflicts[code] += count
+	}
+	for prefix, ps := range other.prefixes {
+		if ws.prefixes[prefix] == nil {
+			ws.prefixes[prefix] = &prefixStats{}
+		}
+		ws.prefixes[prefix].merge(*ps)
+	}
+	ws.multipart.merge(&other.multipart)
+	ws.restoreInits = append(ws.restoreInits, other.restoreInits...)
+	ws.visibilityDelays = append(ws.visibilityDelays, other.visibilityDelays...)
+	ws.visibleFirstRead += other.visibleFirstRead
+	ws.selectStats.merge(other.selectStats)
+	ws.samples = append(ws.samples, other.samples...)
+	ws.failed = append(ws.failed, other.failed...)
+	ws.uploaded = append(ws.uploaded, other.uploaded...)
+}
+
+func (ws *workerStats) isEmpty() bool {
+	return ws.opCount == 0 && ws.abandonedCount == 0 && ws.skippedCount == 0 && len(ws.conflicts) == 0 &&
+		len(ws.multipart.create) == 0 && len(ws.failed) == 0
+}
+
+// collectShard combines the results sent by a shard of numWorkers
+// workers on inCh, and passes them on to outCh once per
+// statsFlushInterval, so that the main collector handles fewer
+// messages. Errors and exits are passed on at once, after the results
+// collected before them. It returns once all the workers have quit.
+func collectShard(inCh <-chan workerMsg, numWorkers int, outCh chan<- workerMsg) {
+	pending := make(map[int]*workerStats)
+	flush := func() {
+		for workerID, ws := range pending {
+			outCh <- workerMsg{stats: ws}
+			delete(pending, workerID)
+		}
+	}
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for numWorkers > 0 {
+		select {
+		case msg := <-inCh:
+			if msg.stats != nil {
+				if ws := pending[msg.stats.workerID]; ws != nil {
+					ws.merge(msg.stats)
+				} else {
+					pending[msg.stats.workerID] = msg.stats
+				}
+				msg.stats = nil
+			}
+			if msg.exitingErr == nil && msg.opErr == nil {
+				continue
+			}
+			flush()
+			outCh <- msg
+			if msg.exitingErr != nil {
+				numWorkers--
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// workerLoop runs operations until the worker's stop criteria are
+// met. Results are collected locally and sent to workerMsgCh
+// periodically and when the worker exits. If sizeCh is not nil,
+// each upload takes its object size from sizeCh and the worker stops
+// when sizeCh is closed.
+func workerLoop(workerID int, objSize int64, sizeCh <-chan int64, testStart time.Time,
+	workerMsgCh chan<- workerMsg, quitChan <-chan struct{}) {
+
+	sessions, err := getWorkerSessions(workerID)
+	if err != nil {
+		workerMsgCh <- workerMsg{exitingErr: err}
+		return
+	}
+	// with -buckets, the worker's operations go to one of the
+	// buckets, on the objects in it.
+	bucket, liveKeys := buckets[workerID%len(buckets)], bucketKeys[workerID%len(buckets)]
+	// session of the endpoint of the running operation, and the
+	// endpoint's index.
+	session := sessions[0]
+	opEndpoint := workerEndpoints[workerID]
+
+	// trace id of the running operation, sent with each of its
+	// requests as a W3C traceparent header.
+	var opTraceID string
+	// server processing time of the running operation, summed over
+	// the Server-Timing headers of its responses, including those
+	// of retried requests.
+	var opServerTime time.Duration
+	var opServerTimed bool
+	for _, sess := range sessions {
+		if exemplars {
+			sess.Handlers.Build.PushBack(func(r *request.Request) {
+				r.HTTPRequest.Header.Set("traceparent", "00-"+opTraceID+"-"+newSpanID()+"-01")
+			})
+		}
+		sess.Handlers.Send.PushBack(func(r *request.Request) {
+			if r.HTTPResponse == nil {
+				return
+			}
+			if header := r.HTTPResponse.Header.Get("Server-Timing"); header != "" {
+				if d, ok := parseServerTiming(header); ok {
+					opServerTime += d
+					opServerTimed = true
+				}
+			}
+		})
+	}
+
+	// random source of this worker, seeded from the run seed so
+	// that the worker's choices are reproducible.
+	workerRand := rand.New(rand.NewSource(randomSeed + int64(workerID)))
+
+	uploader := func(doneCh chan<- workerMsg) {
+		size := pickObjectSize(workerRand, objSize)
+		if sizeCh != nil {
+			var ok bool
+			if size, ok = <-sizeCh; !ok {
+				// no more sizes to upload.
+				doneCh <- workerMsg{exitingErr: errWorkerSucc}
+				return
+			}
+		}
+		var pregenName string
+		if pregenNames != nil {
+			n := atomic.AddInt64(&pregenNamesUsed, 1) - 1
+			if n >= int64(len(pregenNames)) {
+				// all names are uploaded.
+				doneCh <- workerMsg{exitingErr: errWorkerSucc}
+				return
+			}
+			pregenName = pregenNames[n]
+		}
+		// the object is named once, so that each key counts once
+		// for -max-key-length.
+		object := newKeyedObject([]byte(getAlNumPerm(workerRand)), size, "")
+		prefix := sizePrefix(object.ObjectSize)
+		overwrite := false
+		// number of times the overwritten key was taken when it
+		// was picked.
+		var takeCount int
+		if overwriteRatio > 0 && workerRand.Float64() < overwriteRatio {
+			// if no object exists yet, a new one is created.
+			if key, count, ok := liveKeys.randomCounted(workerRand); ok {
+				object.ObjectName, takeCount = key, count
+				overwrite = true
+			}
+		}
+		var err error
+		switch {
+		case overwrite:
+		case hotspotKey != "":
+			object.ObjectName = hotspotKey
+		case pregenName != "":
+			object.ObjectName, err = objectKey(prefix, pregenName)
+		case objKeyTemplate != nil:
+			object.ObjectName, err = objectKey(prefix, objKeyTemplate.expand(strconv.Itoa(workerID), workerRand))
+		case mode == modeReadAfterWrite:
+			object.ObjectName, err = newUnusedName(prefix)
+		case overwriteRatio > 0:
+			// creates must not replace a live object.
+			object.ObjectName, err = liveKeys.newKey(prefix, workerRand)
+		default:
+			object.ObjectName, err = objectKey(prefix, pickObjectName(workerRand))
+		}
+		if err != nil {
+			doneCh <- workerMsg{exitingErr: err}
+			return
+		}
+		startTime := time.Now().UTC()
+
+		s3Client := s3.New(session)
+
+		abandon := abortRate > 0 && workerRand.Float64() < abortRate
+		var checksumDuration time.Duration
+		var etag string
+		var timing *multipartTiming
+		if manualMultipart {
+			timing = &multipartTiming{}
+		}
+		if partSize > 0 {
+			err = multipartUpload(s3Client, bucket, &object, abandon, workerRand, timing)
+			if err != nil {
+				err = fmt.Errorf("Multipart upload Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+			}
+		} else if checksumAlgorithm != "" {
+			// the checksum is computed before the upload, so
+			// that it does not count towards its latency.
+			checksumStart := time.Now()
+			header, value, cerr := objectChecksum(&object)
+			checksumDuration = time.Since(checksumStart)
+			// only the generation during the upload counts.
+			atomic.StoreInt64(&object.genNanos, 0)
+			startTime = time.Now().UTC()
+			if cerr != nil {
+				err = cerr
+			} else {
+				var req *request.Request
+				req, err = putObjectWithChecksum(s3Client, &s3.PutObjectInput{
+					Bucket: aws.String(bucket),
+					Key:    aws.String(object.ObjectName),
+					Body:   &object,
+				}, header, value)
+				if err == nil {
+					etag = aws.StringValue(req.Data.(*s3.PutObjectOutput).ETag)
+				}
+			}
+			if err != nil {
+				err = fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+			}
+		} else {
+			var out *s3.PutObjectOutput
+			out, err = s3Client.PutObject(&s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(object.ObjectName),
+				Body:   &object,
+			})
+			if err != nil {
+				err = fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+			} else {
+				etag = aws.StringValue(out.ETag)
+			}
+		}
+		duration := time.Since(startTime)
+		if err == nil && overwrite && liveKeys.takenSince(object.ObjectName, takeCount) {
+			// another worker deleted the object while it was
+			// overwritten, so the upload may have created it.
+			doneCh <- workerMsg{opType: opPut, skipped: true}
+			return
+		}
+		if err == nil && !abandon && (mode == modeMixed || overwriteRatio > 0) {
+			liveKeys.add(object.ObjectName)
+		}
+		msg := workerMsg{
+			exitingErr:       err,
+			opType:           opPut,
+			putStartTime:     startTime,
+			putDuration:      duration,
+			checksumDuration: checksumDuration,
+			abandoned:        abandon,
+			overwrite:        overwrite,
+			genDuration:      object.genDuration(),
+			objectSize:       size,
+			prefix:           prefix,
+		}
+		if err == nil && timing != nil {
+			msg.multipart = timing
+		}
+		if err == nil && mode == modeReadAfterWrite {
+			// read the object until it is visible.
+			msg.visibilityDelay, msg.visibilityReads, err = waitVisible(s3Client, object.ObjectName, etag, startTime.Add(duration))
+			if err != nil {
+				msg.exitingErr = fmt.Errorf("HeadObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+			}
+		}
+		if hotspotKey != "" && err != nil {
+			if code, ok := conflictCode(err); ok {
+				msg.exitingErr = nil
+				msg.conflictCode = code
+			}
+		}
+		if recordManifest() {
+			msg.objectName = object.ObjectName
+			msg.seedBytes = object.SeedBytes
+		}
+		doneCh <- msg
+	}
+
+	// uploads the next version of one of the version keys.
+	versioner := func(doneCh chan<- workerMsg) {
+		n := atomic.AddInt64(&versionUploadsStarted, 1) - 1
+		if n >= int64(len(versionKeys)*versionCount) {
+			// all versions are uploaded.
+			doneCh <- workerMsg{exitingErr: errWorkerSucc}
+			return
+		}
+		object := newKeyedObject([]byte(getAlNumPerm(workerRand)), pickObjectSize(workerRand, objSize),
+			versionKeys[n%int64(len(versionKeys))])
+		seq := int(n/int64(len(versionKeys))) + 1
+		startTime := time.Now().UTC()
+
+		s3Client := s3.New(session)
+		out, err := s3Client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(object.ObjectName),
+			Body:   &object,
+		})
+		duration := time.Since(startTime)
+		if err == nil && aws.StringValue(out.VersionId) == "" {
+			err = errors.New("no version id returned")
+		}
+		if err != nil {
+			err = fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+		}
+		msg := workerMsg{
+			exitingErr:   err,
+			opType:       opPut,
+			putStartTime: startTime,
+			putDuration:  duration,
+			objectSize:   object.ObjectSize,
+			versionSeq:   seq,
+		}
+		if err == nil && recordManifest() {
+			msg.objectName = object.ObjectName
+			msg.seedBytes = object.SeedBytes
+			msg.versionID = aws.StringValue(out.VersionId)
+		}
+		doneCh <- msg
+	}
+
+	// in delete-markers mode, each worker repeatedly uploads an
+	// object and deletes it, which creates a delete marker. With
+	// -delete-versions, it then permanently deletes the uploaded
+	// version and the delete marker. markerKey is the object of the
+	// current cycle, and markerVersions are its versions left to
+	// delete permanently.
+	var markerKey string
+	var markerVersions []string
+	var markerCreated bool
+	markerDeleter := func(doneCh chan<- workerMsg) {
+		s3Client := s3.New(session)
+		if markerKey == "" {
+			name, err := getRandomObjectName()
+			if err == nil {
+				name, err = objectKey("", name)
+			}
+			object := newKeyedObject([]byte(getAlNumPerm(workerRand)), pickObjectSize(workerRand, objSize), name)
+			if err != nil {
+				doneCh <- workerMsg{exitingErr: err}
+				return
+			}
+			startTime := time.Now().UTC()
+			out, err := s3Client.PutObject(&s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(object.ObjectName),
+				Body:   &object,
+			})
+			duration := time.Since(startTime)
+			if err == nil && aws.StringValue(out.VersionId) == "" {
+				err = errors.New("no version id returned")
+			}
+			if err != nil {
+				err = fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, object.ObjectName, err)
+			} else {
+				markerKey = object.ObjectName
+				markerVersions = []string{aws.StringValue(out.VersionId)}
+				markerCreated = false
+			}
+			doneCh <- workerMsg{
+				exitingErr:   err,
+				opType:       opPut,
+				putStartTime: startTime,
+				putDuration:  duration,
+				objectSize:   object.ObjectSize,
+			}
+			return
+		}
+
+		input := &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(markerKey),
+		}
+		opType := opDeleteMarker
+		if markerCreated {
+			opType = opDeleteVersion
+			input.VersionId = aws.String(markerVersions[0])
+		}
+		startTime := time.Now().UTC()
+		out, err := s3Client.DeleteObject(input)
+		duration := time.Since(startTime)
+		if err == nil && !markerCreated && !aws.BoolValue(out.DeleteMarker) {
+			err = errors.New("no delete marker created")
+		}
+		switch {
+		case err != nil:
+			err = fmt.Errorf("%v Error for bucket %v and key %v - %w", opType, bucket, markerKey, err)
+		case !markerCreated:
+			markerCreated = true
+			markerVersions = append(markerVersions, aws.StringValue(out.VersionId))
+		default:
+			markerVersions = markerVersions[1:]
+		}
+		if err == nil && (!deleteVersions || len(markerVersions) == 0) {
+			// start the next cycle.
+			markerKey = ""
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opType,
+			putStartTime: startTime,
+			putDuration:  duration,
+		}
+	}
+
+	// queries one of the prepopulated objects with S3 Select.
+	selector := func(doneCh chan<- workerMsg) {
+		key, ok := liveKeys.random(workerRand)
+		if !ok {
+			doneCh <- workerMsg{exitingErr: errors.New("no objects to query")}
+			return
+		}
+		s3Client := s3.New(session)
+		startTime := time.Now().UTC()
+		stats, err := selectObject(s3Client, key)
+		duration := time.Since(startTime)
+		if err != nil {
+			err = fmt.Errorf("SelectObjectContent Error for bucket %v and key %v - %w", bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opSelect,
+			putStartTime: startTime,
+			putDuration:  duration,
+			selectStats:  stats,
+		}
+	}
+
+	// uploads a tiny object with as little client work as
+	// possible: its content is a slice of a shared buffer, and its
+	// name one of the generated names.
+	tinyUploader := func(doneCh chan<- workerMsg) {
+		size := pickObjectSize(workerRand, objSize)
+		key := pickObjectName(workerRand)
+		s3Client := s3.New(session)
+		startTime := time.Now().UTC()
+		_, err := s3Client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(tinyContent[:size]),
+		})
+		duration := time.Since(startTime)
+		if err != nil {
+			err = fmt.Errorf("PutObject Error for bucket %v and key %v - %w", bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opPut,
+			putStartTime: startTime,
+			putDuration:  duration,
+			objectSize:   size,
+		}
+	}
+
+	// deletes one of the prepopulated objects, each only once.
+	deleter := func(doneCh chan<- workerMsg) {
+		key, ok := liveKeys.take(workerRand)
+		if !ok {
+			// all objects are deleted.
+			doneCh <- workerMsg{exitingErr: errWorkerSucc}
+			return
+		}
+		s3Client := s3.New(session)
+		startTime := time.Now().UTC()
+		err := deleteObject(s3Client, bucket, key)
+		duration := time.Since(startTime)
+		liveKeys.done(key)
+		if err != nil {
+			err = fmt.Errorf("Delete Error for bucket %v and key %v - %w", bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opDelete,
+			putStartTime: startTime,
+			putDuration:  duration,
+		}
+	}
+
+	// restores one of the tiered objects and waits until it is
+	// readable.
+	restorer := func(doneCh chan<- workerMsg) {
+		key, ok := liveKeys.take(workerRand)
+		if !ok {
+			// all objects are restored.
+			doneCh <- workerMsg{exitingErr: errWorkerSucc}
+			return
+		}
+		s3Client := s3.New(session)
+		startTime := time.Now().UTC()
+		initDuration, err := restoreObject(s3Client, key)
+		duration := time.Since(startTime)
+		liveKeys.done(key)
+		if err != nil {
+			err = fmt.Errorf("Restore Error for bucket %v and key %v - %w", bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opRestore,
+			putStartTime: startTime,
+			putDuration:  duration,
+			restoreInit:  initDuration,
+		}
+	}
+
+	lister := func(doneCh chan<- workerMsg) {
+		startTime := time.Now().UTC()
+
+		s3Client := s3.New(session)
+
+		var listed int64
+		err := s3Client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+			Bucket: aws.String(bucket),
+		}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+			listed += int64(len(page.Uploads))
+			return true
+		})
+		duration := time.Since(startTime)
+		if err != nil {
+			err = fmt.Errorf("ListMultipartUploads Error for bucket %v - %w", bucket, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opList,
+			putStartTime: startTime,
+			putDuration:  duration,
+			listedCount:  listed,
+		}
+	}
+
+	// runs an operation on an existing object, picked from the
+	// live objects.
+	existingObjectOp := func(doneCh chan<- workerMsg, opType string) {
+		var key string
+		var ok bool
+		// number of times the key was taken when it was picked.
+		var takeCount int
+		if targetKey != "" {
+			key, ok = targetKey, true
+		} else if opType == opDelete {
+			// take the key, so that no other worker deletes
+			// it too.
+			key, ok = liveKeys.take(workerRand)
+		} else {
+			key, takeCount, ok = liveKeys.randomCounted(workerRand)
+		}
+		if !ok {
+			// no objects exist yet - upload one instead.
+			uploader(doneCh)
+			return
+		}
+
+		s3Client := s3.New(session)
+		startTime := time.Now().UTC()
+		var size int64
+		var err error
+		switch opType {
+		case opGet:
+			size, err = getObject(s3Client, bucket, key)
+		case opStat:
+			size, err = statObject(s3Client, bucket, key)
+		case opDelete:
+			err = deleteObject(s3Client, bucket, key)
+			if targetKey == "" {
+				liveKeys.done(key)
+			}
+		case opAttributes:
+			size, err = getObjectAttributes(s3Client, bucket, key)
+		}
+		duration := time.Since(startTime)
+		if opType != opDelete && targetKey == "" && isNotFound(err) && liveKeys.takenSince(key, takeCount) {
+			// another worker deleted the object while it was
+			// read.
+			doneCh <- workerMsg{opType: opType, skipped: true}
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("%v Error for bucket %v and key %v - %w", opType, bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opType,
+			putStartTime: startTime,
+			putDuration:  duration,
+			objectSize:   size,
+		}
+	}
+
+	// presignedGetter downloads an object via a presigned URL. The
+	// time taken to presign the URL is recorded separately from the
+	// download latency.
+	presignedGetter := func(doneCh chan<- workerMsg) {
+		key, ok := targetKey, true
+		if targetKey == "" {
+			key, ok = liveKeys.random(workerRand)
+		}
+		if !ok {
+			doneCh <- workerMsg{exitingErr: errors.New("no objects to download")}
+			return
+		}
+
+		s3Client := s3.New(session)
+		signStart := time.Now()
+		presignedURL, err := presignGetObject(s3Client, bucket, key)
+		signDuration := time.Since(signStart)
+		if err != nil {
+			doneCh <- workerMsg{exitingErr: fmt.Errorf("Presign Error for bucket %v and key %v - %w", bucket, key, err)}
+			return
+		}
+
+		startTime := time.Now().UTC()
+		size, err := downloadURL(presignedURL)
+		duration := time.Since(startTime)
+		if err != nil {
+			err = fmt.Errorf("Presigned GET Error for bucket %v and key %v - %w", bucket, key, err)
+		}
+		doneCh <- workerMsg{
+			exitingErr:   err,
+			opType:       opGet,
+			putStartTime: startTime,
+			putDuration:  duration,
+			signDuration: signDuration,
+			objectSize:   size,
+		}
+	}
+
+	// type of the next operation in mixed mode, picked before the
+	// operation waits for -rate.
+	var mixedOpType string
+	mixed := func(doneCh chan<- workerMsg) {
+		if mixedOpType == opPut {
+			uploader(doneCh)
+		} else {
+			existingObjectOp(doneCh, mixedOpType)
+		}
+	}
+
+	operation := uploader
+	switch mode {
+	case modeListIncomplete:
+		operation = lister
+	case modeMixed:
+		operation = mixed
+	case modeAttributes:
+		operation = func(doneCh chan<- workerMsg) {
+			existingObjectOp(doneCh, opAttributes)
+		}
+	case modeVersions:
+		operation = versioner
+	case modePresignedGet:
+		operation = presignedGetter
+	case modeDeleteMarkers:
+		operation = markerDeleter
+	case modeRestore:
+		operation = restorer
+	case modeSelect:
+		operation = selector
+	case modeTiny:
+		operation = tinyUploader
+	case modeGet:
+		operation = func(doneCh chan<- workerMsg) {
+			existingObjectOp(doneCh, opGet)
+		}
+	case modeDelete:
+		operation = deleter
+	case modeStat:
+		operation = func(doneCh chan<- workerMsg) {
+			existingObjectOp(doneCh, opStat)
+		}
+	case modeProbe:
+		if targetKey != "" {
+			// monitor the download latency of the target
+			// key.
+			operation = func(doneCh chan<- workerMsg) {
+				existingObjectOp(doneCh, opGet)
+			}
+		}
+	}
+
+	// start time of the running operation, to measure the time
+	// until a failed operation failed.
+	var opStartTime time.Time
+
+	// wait for the given delay and think time, and while the load
+	// is paused, before each operation.
+	runOperation := func(doneCh chan<- workerMsg, delay, think time.Duration) {
+		time.Sleep(delay + think)
+		atomic.AddInt64(&thinkTimeTotal, int64(think))
+		loadPauser.wait()
+		if mode == modeMixed {
+			mixedOpType = workload.pick(workerRand)
+		}
+		// the operation waits for -rate before it takes a slot of
+		// -adaptive, so that the wait does not count as latency.
+		if rateBucket != nil && (mode != modeMixed || rateOps == nil || rateOps[mixedOpType]) {
+			rateBucket.wait()
+		}
+		if limiter != nil {
+			limiter.acquire()
+			defer limiter.release()
+		}
+		if exemplars {
+			opTraceID = newTraceID()
+		}
+		opServerTime, opServerTimed = 0, false
+		if len(sessions) > 1 {
+			opEndpoint = pickEndpoint(workerRand)
+			session = sessions[opEndpoint]
+		}
+		opStartTime = time.Now()
+		operation(doneCh)
+	}
+
+	// delay between operations.
+	var opDelay time.Duration
+	if mode == modeProbe {
+		opDelay = probeInterval
+	}
+
+	// time spent thinking by this worker.
+	var workerThinkTime time.Duration
+
+	var output *workerOutput
+	if perWorkerDir != "" {
+		if output, err = newWorkerOutput(workerID); err != nil {
+			workerMsgCh <- workerMsg{exitingErr: err}
+			return
+		}
+		defer func() {
+			if err := output.close(); err != nil {
+				fmt.Printf("Error writing %v: %v\n", output.f.Name(), err)
+			}
+		}()
+	}
+
+	stats := newWorkerStats(workerID)
+	flushTicker := time.NewTicker(statsFlushInterval)
+	defer flushTicker.Stop()
+
+	// flush sends the results collected since the last flush to
+	// the collector, along with the worker's exit error if any.
+	flush := func(exitingErr error) {
+		if exitingErr == nil && stats.isEmpty() {
+			return
+		}
+		if exitingErr != nil && recordConcurrency {
+			stats.activeEnd = time.Now().UTC()
+		}
+		workerMsgCh <- workerMsg{exitingErr: exitingErr, stats: stats}
+		stats = newWorkerStats(workerID)
+	}
+
+	// buffered channel so that operation go routine does not hang.
+	doneCh := make(chan workerMsg, 1)
+	opCount := 0
+	timeStart := time.Now().UTC()
+	pausedAtStart := loadPauser.totalPaused()
+	var jitter time.Duration
+	if startJitter > 0 {
+		jitter = time.Duration(workerRand.Int63n(int64(startJitter) + 1))
+	}
+	go runOperation(doneCh, jitter, 0)
+	toQuit := false
+	started := false
+	for !toQuit {
+		select {
+		case opMsg := <-doneCh:
+			if recordConcurrency && !started {
+				started = true
+				stats.activeStart = opStartTime.UTC()
+			}
+			if opMsg.exitingErr == nil && output != nil {
+				if err := output.write(opMsg); err != nil {
+					opMsg.exitingErr = fmt.Errorf("Writing %v failed - %w", output.f.Name(), err)
+				}
+			}
+			tolerated := opMsg.exitingErr != nil && maxConsecutiveErrors > 1 &&
+				opMsg.exitingErr != errWorkerSucc && opMsg.exitingErr != errWorkerQuit
+			if opMsg.exitingErr != nil && !tolerated {
+				flush(opMsg.exitingErr)
+				toQuit = true
+			} else {
+				if tolerated {
+					errDuration := time.Since(opStartTime)
+					if parquetFile != "" || sqliteFile != "" {
+						stats.failed = append(stats.failed, opSample{
+							opType:    opMsg.opType,
+							startTime: opStartTime.UTC(),
+							duration:  errDuration,
+							workerID:  workerID,
+							endpoint:  opEndpoint,
+						})
+					}
+					// report the error after the results before
+					// it, and let the collector decide whether
+					// to abort the test.
+					flush(nil)
+					workerMsgCh <- workerMsg{
+						opErr:       opMsg.exitingErr,
+						errDuration: errDuration,
+					}
+				} else {
+					// the operation's goroutine has finished
+					// with opTraceID and opServerTime when its
+					// result is received.
+					opMsg.serverTime, opMsg.serverTimed = opServerTime, opServerTimed
+					opMsg.endpoint = opEndpoint
+					if metrics != nil && !opMsg.skipped {
+						opMsg.traceID = opTraceID
+						metrics.observe(opMsg)
+					}
+					stats.add(opMsg, testStart)
+					if len(stats.samples) >= batchSize {
+						flush(nil)
+					}
+					opCount++
+				}
+				// paused and think time do not count
+				// toward the worker duration.
+				activeTime := time.Since(timeStart) -
+					(loadPauser.totalPaused() - pausedAtStart) -
+					workerThinkTime
+				more := sizeCh != nil || mode == modeVersions || mode == modeRestore || mode == modeDelete ||
+					pregenNames != nil || syncStop ||
+					activeTime < workerDuration ||
+					opCount < minUploadCount
+				if iterationsPerWorker > 0 {
+					// the worker stops after its iterations,
+					// whatever the duration.
+					more = opCount < iterationsPerWorker
+				}
+				if more {
+					think := thinkTime.pick(workerRand)
+					workerThinkTime += think
+					go runOperation(doneCh, opDelay, think)
+				} else {
+					flush(errWorkerSucc)
+					toQuit = true
+				}
+			}
+		case <-flushTicker.C:
+			flush(nil)
+		case <-quitChan:
+			flush(errWorkerQuit)
+			toQuit = true
+		}
+	}
+}
+
+type TestResult struct {
+	// number of successful operations of each type.
+	opCounts map[string]int64
+
+	// sample of each successful operation. If maxSamples is set,
+	// this is a uniform random sample of at most maxSamples
+	// operations.
+	samples []opSample
+
+	// failed operations, with -parquet and -sqlite.
+	failed []opSample
+
+	// number of samples offered to the sample slices, and the
+	// random source used to pick samples once they are full.
+	samplesSeen int64
+	sampleRand  *rand.Rand
+
+	startTime   time.Time
+	objectCount int64
+
+	// time at which the test ended - zero while it runs.
+	endTime time.Time
+
+	// total size of all uploaded and downloaded objects.
+	bytesWritten int64
+	bytesRead    int64
+
+	// number of multipart uploads deliberately left incomplete.
+	abandonedCount int64
+
+	// number of operations skipped as another worker deleted their
+	// object, in mixed mode.
+	skippedCount int64
+
+	// number of conflict responses to uploads of the hotspot key,
+	// keyed by error code.
+	conflicts map[string]int64
+
+	// totals of the operations sent to each endpoint.
+	endpointStats []endpointStats
+
+	// uploaded objects by key prefix, with -size-prefix.
+	prefixes map[string]*prefixStats
+
+	// latencies of the steps of multipart uploads, with
+	// -manual-multipart.
+	multipart multipartLatencies
+
+	// latencies of initiating restores, in restore mode.
+	restoreInits []time.Duration
+
+	// delays until uploaded objects were visible, and the number
+	// visible on the first read, in read-after-write mode.
+	visibilityDelays []time.Duration
+	visibleFirstRead int64
+
+	// bytes scanned and returned by the queries in select mode.
+	selectStats selectStats
+
+	// total duration of all successful operations, the total time
+	// taken to presign their URLs in presigned-get mode, and to
+	// compute the checksums of uploads with -checksum.
+	totalDuration    time.Duration
+	signDuration     time.Duration
+	checksumDuration time.Duration
+
+	// number of incomplete uploads seen by list operations.
+	listedCount int64
+
+	// number of uploads that overwrote an existing object, with
+	// -overwrite-ratio.
+	overwriteCount int64
+
+	// time spent generating the content of uploads, and their
+	// total duration, with -measure-generation.
+	genDuration       time.Duration
+	genUploadDuration time.Duration
+
+	// server processing times of the operations with Server-Timing
+	// headers.
+	serverTiming serverTiming
+
+	// number and latency of the operations completed in each
+	// second of the test.
+	secondCount   []int64
+	secondLatency []secondLatency
+
+	// times at which the first and the last worker finished
+	// successfully.
+	firstWorkerDone time.Time
+	lastWorkerDone  time.Time
+
+	// time each worker was active, with -record-concurrency.
+	activeSpans []activeSpan
+
+	// last upload of each object, if the manifest is recorded.
+	manifest map[string]manifestEntry
+
+	// number of failed operations, by whether the failure was
+	// caused by an injected fault.
+	injectedErrorCount int64
+	realErrorCount     int64
+
+	// latencies of the failed operations, with -record-error-latency.
+	errorLatencies []time.Duration
+
+	// number of new and reused connections, and of new connections
+	// in each second of the test, with -conn-stats.
+	newConns       int64
+	reusedConns    int64
+	secondNewConns []int64
+
+	// window of operations in flight, with -adaptive.
+	adaptive adaptiveSummary
+
+	// uploads of the health-check probe, with -healthcheck.
+	healthchecks []healthcheckSample
+}
+
+// connSummary summarizes the connections requests were sent on.
+type connSummary struct {
+	New       int64   `json:"new"`
+	Reused    int64   `json:"reused"`
+	NewPerSec float64 `json:"newPerSec"`
+}
+
+// getPresignMessage reports the average time taken to presign a
+// URL in presigned-get mode.
+func (tr *TestResult) getPresignMessage() string {
+	if mode != modePresignedGet || tr.objectCount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Avg URL presigning time: %v (not included in the download latencies).\n",
+		tr.signDuration/time.Duration(tr.objectCount))
+}
+
+// getChecksumMessage reports the client CPU time taken to compute
+// the checksums of uploads, with -checksum.
+func (tr *TestResult) getChecksumMessage() string {
+	uploads := tr.opCounts[opPut]
+	if checksumAlgorithm == "" || uploads == 0 {
+		return ""
+	}
+	msg := fmt.Sprintf("Avg %v checksum time: %v per upload (not included in the upload latencies)",
+		checksumAlgorithm, tr.checksumDuration/time.Duration(uploads))
+	if tr.checksumDuration > 0 {
+		msg += fmt.Sprintf(" - %.2f MiB/s per core", float64(tr.bytesWritten)/(tr.checksumDuration.Seconds()*1024*1024))
+	}
+	return msg + ".\n"
+}
+
+// getGenerationMessage reports the time spent generating the content
+// of uploads, and its share of the upload latencies, with
+// -measure-generation.
+func (tr *TestResult) getGenerationMessage() string {
+	uploads := tr.opCounts[opPut]
+	if !measureGeneration || uploads == 0 || tr.genUploadDuration == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Avg content generation time: %v per upload - %.2f%% of the upload latency.\n",
+		tr.genDuration/time.Duration(uploads),
+		100*float64(tr.genDuration)/float64(tr.genUploadDuration))
+}
+
+// serverTiming totals the server processing times reported in
+// Server-Timing headers, and the latencies of the same operations.
+type serverTiming struct {
+	ops        int64
+	serverTime time.Duration
+	latency    time.Duration
+}
+
+func (st *serverTiming) merge(other serverTiming) {
+	st.ops += other.ops
+	st.serverTime += other.serverTime
+	st.latency += other.latency
+}
+
+// parseServerTiming returns the processing time in a Server-Timing
+// header, e.g. "db;dur=53, total;dur=120.5": the duration of its
+// total metric if it has one, and the sum of the durations of its
+// metrics otherwise. Returns false if no duration is found.
+func parseServerTiming(header string) (time.Duration, bool) {
+	var sum, total float64
+	var found, hasTotal bool
+	for _, metric := range strings.Split(header, ",") {
+		params := strings.Split(metric, ";")
+		name := strings.TrimSpace(params[0])
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "dur") {
+				continue
+			}
+			ms, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(kv[1]), `"`), 64)
+			if err != nil {
+				continue
+			}
+			found = true
+			sum += ms
+			if strings.EqualFold(name, "total") {
+				total, hasTotal = ms, true
+			}
+		}
+	}
+	if hasTotal {
+		sum = total
+	}
+	return time.Duration(sum * float64(time.Millisecond)), found
+}
+
+// serverTimingSummary summarizes the server processing times of the
+// operations with Server-Timing headers.
+type serverTimingSummary struct {
+	Operations     int64   `json:"operations"`
+	AvgServerNs    int64   `json:"avgServerNs"`
+	AvgLatencyNs   int64   `json:"avgLatencyNs"`
+	ServerFraction float64 `json:"serverFraction"`
+}
+
+func (st serverTiming) summary() *serverTimingSummary {
+	if st.ops == 0 {
+		return nil
+	}
+	sum := &serverTimingSummary{
+		Operations:   st.ops,
+		AvgServerNs:  int64(st.serverTime) / st.ops,
+		AvgLatencyNs: int64(st.latency) / st.ops,
+	}
+	if st.latency > 0 {
+		sum.ServerFraction = float64(st.serverTime) / float64(st.latency)
+	}
+	return sum
+}
+
+// getServerTimingMessage reports the server processing time of the
+// operations whose responses had Server-Timing headers.
+func (tr *TestResult) getServerTimingMessage() string {
+	sum := tr.serverTiming.summary()
+	if sum == nil {
+		return ""
+	}
+	return fmt.Sprintf("Server-Timing: reported for %v of %v operations - avg server time %v of avg latency %v (%.1f%%), the rest is network and client time.\n",
+		sum.Operations, tr.objectCount, time.Duration(sum.AvgServerNs),
+		time.Duration(sum.AvgLatencyNs), 100*sum.ServerFraction)
+}
+
+// getConnMessage reports the new and reused connections, with
+// -conn-stats.
+func (tr *TestResult) getConnMessage() string {
+	if conns == nil {
+		return ""
+	}
+	var perSec float64
+	if timeSoFar := tr.activeSeconds(); timeSoFar > 0 {
+		perSec = float64(tr.newConns) / timeSoFar
+	}
+	msg := fmt.Sprintf("Connections: %v new (%.2f/s), %v reused",
+		tr.newConns, perSec, tr.reusedConns)
+	if total := tr.newConns + tr.reusedConns; total > 0 {
+		msg += fmt.Sprintf(" - %.1f%% of requests opened a new connection",
+			100*float64(tr.newConns)/float64(total))
+	}
+	return msg + ".\n"
+}
+
+// getFaultMessage reports the injected faults and the errors they
+// caused.
+func (tr *TestResult) getFaultMessage() string {
+	if !faults.enabled() {
+		return ""
+	}
+	return fmt.Sprintf("Injected %v errors and %v delays. Failed operations: %v due to injected faults, %v due to other errors.\n",
+		atomic.LoadInt64(&injectedErrors), atomic.LoadInt64(&injectedDelays),
+		tr.injectedErrorCount, tr.realErrorCount)
+}
+
+// getErrorLatencyMessage returns the percentiles of the time until
+// the failed operations failed, with -record-error-latency.
+func (tr *TestResult) getErrorLatencyMessage() string {
+	if !recordErrorLatency || len(tr.errorLatencies) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Failed operation latency (%v operations): %v\n", len(tr.errorLatencies),
+		getPercentilesMessage(sortDurations(tr.errorLatencies)))
+}
+
+// getConflictMessage returns the number of conflict responses to
+// uploads of the hotspot key.
+func (tr *TestResult) getConflictMessage() string {
+	if hotspotKey == "" {
+		return ""
+	}
+	if len(tr.conflicts) == 0 {
+		return "No conflict responses.\n"
+	}
+	codes := make([]string, 0, len(tr.conflicts))
+	for code := range tr.conflicts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	msg := "Conflict responses:"
+	for i, code := range codes {
+		if i > 0 {
+			msg += ","
+		}
+		msg += fmt.Sprintf(" %v %v", tr.conflicts[code], code)
+	}
+	return msg + ".\n"
+}
+
+// versionBucket is the latency of the uploads of a range of version
+// sequence numbers.
+type versionBucket struct {
+	FirstVersion int            `json:"firstVersion"`
+	LastVersion  int            `json:"lastVersion"`
+	Latency      latencySummary `json:"latency"`
+}
+
+// maximum number of version ranges latencies are reported for.
+const maxVersionBuckets = 10
+
+// versionBuckets returns the upload latencies of the versions mode
+// by ranges of version sequence numbers, to show whether the write
+// latency grows with the number of versions of a key.
+func (tr *TestResult) versionBuckets() []versionBucket {
+	width := (versionCount + maxVersionBuckets - 1) / maxVersionBuckets
+	var buckets []versionBucket
+	for first := 1; first <= versionCount; first += width {
+		last := first + width - 1
+		if last > versionCount {
+			last = versionCount
+		}
+		var sorted []time.Duration
+		for _, sample := range tr.samples {
+			if sample.versionSeq >= first && sample.versionSeq <= last {
+				sorted = append(sorted, sample.duration)
+			}
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		buckets = append(buckets, versionBucket{
+			FirstVersion: first,
+			LastVersion:  last,
+			Latency:      newLatencySummary(sorted),
+		})
+	}
+	return buckets
+}
+
+// getVersionMessage returns the upload latencies of the versions
+// mode by ranges of version sequence numbers.
+func (tr *TestResult) getVersionMessage() string {
+	if mode != modeVersions {
+		return ""
+	}
+	var msg string
+	for _, b := range tr.versionBuckets() {
+		if b.Latency.Samples == 0 {
+			continue
+		}
+		msg += fmt.Sprintf("Versions %v-%v: %v uploads, latency p50 %v, p90 %v, p99 %v.\n",
+			b.FirstVersion, b.LastVersion, b.Latency.Samples,
+			time.Duration(b.Latency.P50), time.Duration(b.Latency.P90),
+			time.Duration(b.Latency.P99))
+	}
+	return msg
+}
+
+// getPrefixMessage returns the number and sizes of the objects
+// uploaded under each key prefix.
+func (tr *TestResult) getPrefixMessage() string {
+	if sizePrefixes == nil {
+		return ""
+	}
+	prefixes := make([]string, 0, len(tr.prefixes))
+	for prefix := range tr.prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	var msg string
+	for _, prefix := range prefixes {
+		ps := tr.prefixes[prefix]
+		msg += fmt.Sprintf("Prefix %q: %v objects, %.2f MiB, sizes %v to %v bytes (avg %v).\n",
+			prefix, ps.Count, float64(ps.Bytes)/(1024*1024),
+			ps.MinSize, ps.MaxSize, ps.Bytes/ps.Count)
+	}
+	return msg
+}
+
+// recordWorkerDone records the time at which a worker finished.
+func (tr *TestResult) recordWorkerDone(t time.Time) {
+	if tr.firstWorkerDone.IsZero() {
+		tr.firstWorkerDone = t
+	}
+	tr.lastWorkerDone = t
+}
+
+// getStaggerMessage returns a warning if workers finished over a
+// span longer than staggerWarn, as the test then ended with a
+// declining concurrency.
+func (tr *TestResult) getStaggerMessage() string {
+	spread := tr.lastWorkerDone.Sub(tr.firstWorkerDone)
+	if spread <= staggerWarn {
+		return ""
+	}
+	msg := fmt.Sprintf("Warning: workers finished over a span of %v, so the end of the test ran with declining concurrency.",
+		spread.Round(time.Millisecond))
+	if excludeRampdown {
+		msg += " Operations started after the first worker finished are excluded from latency statistics."
+	}
+	return msg + "\n"
+}
+
+// secondLatency is the total and the maximum latency of the
+// operations completed in one second of the test.
+type secondLatency struct {
+	total time.Duration
+	max   time.Duration
+}
+
+func (sl *secondLatency) merge(other secondLatency) {
+	sl.total += other.total
+	if other.max > sl.max {
+		sl.max = other.max
+	}
+}
+
+// secondPercentiles returns the p-th percentile of the latencies of
+// the operation samples completed in each second of the test.
+func (tr *TestResult) secondPercentiles(p float64) []time.Duration {
+	bySecond := make([][]time.Duration, len(tr.secondCount))
+	for _, sample := range tr.samples {
+		sec := int(sample.startTime.Add(sample.duration).Sub(tr.startTime) / time.Second)
+		if sec >= 0 && sec < len(bySecond) {
+			bySecond[sec] = append(bySecond[sec], sample.duration)
+		}
+	}
+	percentiles := make([]time.Duration, len(bySecond))
+	for sec, sorted := range bySecond {
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		percentiles[sec] = percentile(sorted, p)
+	}
+	return percentiles
+}
+
+// endpointStats are the totals of the operations sent to one
+// endpoint.
+type endpointStats struct {
+	opCount       int64
+	bytesWritten  int64
+	bytesRead     int64
+	totalDuration time.Duration
+}
+
+// add records a successful operation sent to the endpoint.
+func (es *endpointStats) add(msg workerMsg) {
+	es.opCount++
+	switch msg.opType {
+	case opGet:
+		es.bytesRead += msg.objectSize
+	case opStat:
+	default:
+		es.bytesWritten += msg.objectSize
+	}
+	es.totalDuration += msg.putDuration
+}
+
+func (es *endpointStats) merge(other endpointStats) {
+	es.opCount += other.opCount
+	es.bytesWritten += other.bytesWritten
+	es.bytesRead += other.bytesRead
+	es.totalDuration += other.totalDuration
+}
+
+// addStats merges results sent by a worker.
+func (tr *TestResult) addStats(ws *workerStats) {
+	for i := range ws.endpointStats {
+		tr.endpointStats[i].merge(ws.endpointStats[i])
+	}
+
+	tr.objectCount += ws.opCount
+	tr.bytesWritten += ws.bytesWritten
+	tr.bytesRead += ws.bytesRead
+	tr.totalDuration += ws.totalDuration
+	tr.signDuration += ws.signDuration
+	tr.checksumDuration += ws.checksumDuration
+	tr.abandonedCount += ws.abandonedCount
+	tr.skippedCount += ws.skippedCount
+	tr.listedCount += ws.listedCount
+	tr.overwriteCount += ws.overwriteCount
+	tr.genDuration += ws.genDuration
+	tr.genUploadDuration += ws.genUploadDuration
+	if tr.activeSpans != nil {
+		if !ws.activeStart.IsZero() {
+			tr.activeSpans[ws.workerID].start = ws.activeStart
+		}
+		if !ws.activeEnd.IsZero() {
+			tr.activeSpans[ws.workerID].end = ws.activeEnd
+		}
+	}
+	tr.serverTiming.merge(ws.serverTiming)
+	tr.multipart.merge(&ws.multipart)
+	tr.restoreInits = append(tr.restoreInits, ws.restoreInits...)
+	tr.visibilityDelays = append(tr.visibilityDelays, ws.visibilityDelays...)
+	tr.visibleFirstRead += ws.visibleFirstRead
+	tr.selectStats.merge(ws.selectStats)
+	for opType, count := range ws.opCounts {
+		tr.opCounts[opType] += count
+	}
+	for code, count := range ws.conflicts {
+		tr.conflicts[code] += count
+	}
+	for prefix, ps := range ws.prefixes {
+		if tr.prefixes[prefix] == nil {
+			tr.prefixes[prefix] = &prefixStats{}
+		}
+		tr.prefixes[prefix].merge(*ps)
+	}
+	for sec, count := range ws.secondCount {
+		if sec < 0 {
+			continue
+		}
+		for int64(len(tr.secondCount)) <= sec {
+			tr.secondCount = append(tr.secondCount, 0)
+			tr.secondLatency = append(tr.secondLatency, secondLatency{})
+		}
+		tr.secondCount[sec] += count
+		tr.secondLatency[sec].merge(ws.secondLatency[sec])
+	}
+	for _, sample := range ws.samples {
+		tr.addSample(sample)
+	}
+	tr.failed = append(tr.failed, ws.failed...)
+	for _, entry := range ws.uploaded {
+		// workers flush independently, so keep the upload that
+		// completed last.
+		if prev, ok := tr.manifest[entry.Key]; !ok || entry.endTime.After(prev.endTime) {
+			tr.manifest[entry.Key] = entry
+		}
+	}
+}
+
+// addSample records an operation sample. Once maxSamples samples
+// are kept, reservoir sampling is used so that the kept samples
+// remain a uniform random sample of all operations.
+func (tr *TestResult) addSample(sample opSample) {
+	tr.samplesSeen++
+	if maxSamples == 0 || len(tr.samples) < maxSamples {
+		tr.samples = append(tr.samples, sample)
+		return
+	}
+	if j := tr.sampleRand.Int63n(tr.samplesSeen); j < int64(maxSamples) {
+		tr.samples[j] = sample
+	}
+}
+
+// sortedDurations returns a sorted copy of the durations of
+// operations of the given type, or of all operations if opType is
+// empty. With excludeRampdown, operations started after the first
+// worker finished are left out.
+func (tr *TestResult) sortedDurations(opType string) []time.Duration {
+	return tr.sortedDurationsFunc(func(sample opSample) bool {
+		return opType == "" || sample.opType == opType
+	})
+}
+
+// sortedDurationsFunc returns a sorted copy of the durations of the
+// operations for which keep returns true, honouring excludeRampdown
+// like sortedDurations.
+func (tr *TestResult) sortedDurationsFunc(keep func(opSample) bool) []time.Duration {
+	sorted := make([]time.Duration, 0, len(tr.samples))
+	for _, sample := range tr.samples {
+		if !keep(sample) {
+			continue
+		}
+		if excludeRampdown && !tr.firstWorkerDone.IsZero() &&
+			!sample.startTime.Before(tr.firstWorkerDone) {
+			continue
+		}
+		sorted = append(sorted, sample.duration)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// sortedRates returns the sorted transfer rates in MiB/s of the
+// uploads and downloads with content. With excludeRampdown,
+// operations started after the first worker finished are left out.
+func (tr *TestResult) sortedRates() []float64 {
+	if mode == modeTiny {
+		// the rates of tiny objects only reflect their latency.
+		return nil
+	}
+	var sorted []float64
+	for _, sample := range tr.samples {
+		if (sample.opType != opPut && sample.opType != opGet) ||
+			sample.size == 0 || sample.duration <= 0 {
+			continue
+		}
+		if excludeRampdown && !tr.firstWorkerDone.IsZero() &&
+			!sample.startTime.Before(tr.firstWorkerDone) {
+			continue
+		}
+		sorted = append(sorted, float64(sample.size)/(1024*1024)/sample.duration.Seconds())
+	}
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// percentileIndex returns the index of the p-th percentile
+// (0 < p <= 100) of n sorted values, using the nearest-rank method.
+func percentileIndex(n int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(n)))
+	if rank < 1 {
+		rank = 1
+	}
+	return rank - 1
+}
+
+// percentile returns the p-th percentile (0 < p <= 100) of the
+// sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileIndex(len(sorted), p)]
+}
+
+// parsePercentiles parses a list of percentiles, e.g.
+// "50,90,99,99.9", and returns them in increasing order.
+func parsePercentiles(spec string) ([]float64, error) {
+	var ps []float64
+	for _, s := range strings.Split(spec, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q", s)
+		}
+		ps = append(ps, p)
+	}
+	sort.Float64s(ps)
+	return ps, nil
+}
+
+// percentileName returns the name of the p-th percentile, e.g.
+// "p99.9".
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// getPercentilesMessage returns the latencyPercentiles of the
+// sorted durations, e.g. "p50 1ms, p99 5ms".
+func getPercentilesMessage(sorted []time.Duration) string {
+	parts := make([]string, 0, len(latencyPercentiles))
+	for _, p := range latencyPercentiles {
+		parts = append(parts, fmt.Sprintf("%v %v", percentileName(p), percentile(sorted, p)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// minPercentileSamples returns the number of samples needed for
+// the p-th percentile to be above the maximum - with fewer, the
+// percentile is the slowest sample and says little about the tail.
+func minPercentileSamples(p float64) int {
+	if p >= 100 {
+		return 1
+	}
+	// the small offset keeps rounding errors from adding one.
+	return int(math.Ceil(100/(100-p) - 1e-9))
+}
+
+// getPercentileWarning warns about the percentiles that are based
+// on too few samples to be meaningful.
+func getPercentileWarning(samples int) string {
+	var msg string
+	for _, p := range latencyPercentiles {
+		if need := minPercentileSamples(p); samples < need {
+			msg += fmt.Sprintf("Warning: %v is based on %v samples - at least %v are needed for it to be meaningful.\n",
+				percentileName(p), samples, need)
+		}
+	}
+	return msg
+}
+
+// ratePercentile returns the p-th percentile (0 < p <= 100) of the
+// sorted rates.
+func ratePercentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[percentileIndex(len(sorted), p)]
+}
+
+// getRateMessage returns a summary of the per-object transfer rates.
+// Low percentiles are the slow transfers.
+func (tr *TestResult) getRateMessage() string {
+	sorted := tr.sortedRates()
+	if len(sorted) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Per-object transfer rate: min %.2f, p10 %.2f, p50 %.2f, p90 %.2f, max %.2f MiB/s.\n",
+		sorted[0], ratePercentile(sorted, 10), ratePercentile(sorted, 50),
+		ratePercentile(sorted, 90), sorted[len(sorted)-1])
+}
+
+// getLatencyMessage returns a summary of the operation latencies.
+func (tr *TestResult) getLatencyMessage() string {
+	sorted := tr.sortedDurations("")
+	if len(sorted) == 0 {
+		return "No operation latencies recorded.\n"
+	}
+	msg := fmt.Sprintf("Latency: min %v, %v, max %v",
+		sorted[0], getPercentilesMessage(sorted), sorted[len(sorted)-1])
+	if tr.samplesSeen > int64(len(sorted)) {
+		msg += fmt.Sprintf(" (from a sample of %v of %v operations)",
+			len(sorted), tr.samplesSeen)
+	}
+	return msg + ".\n" + getPercentileWarning(len(sorted))
+}
+
+// opTypes returns the sorted operation types of the test: those
+// that completed, and in mixed mode those in the workload.
+func (tr *TestResult) opTypes() []string {
+	seen := make(map[string]bool)
+	var opTypes []string
+	for opType := range tr.opCounts {
+		seen[opType] = true
+		opTypes = append(opTypes, opType)
+	}
+	if mode == modeMixed {
+		for _, opType := range workload.opTypes {
+			if !seen[opType] {
+				opTypes = append(opTypes, opType)
+			}
+		}
+	}
+	sort.Strings(opTypes)
+	return opTypes
+}
+
+// getOpMessage returns the rate and latencies of each operation
+// type.
+func (tr *TestResult) getOpMessage() string {
+	timeSoFar := tr.activeSeconds()
+	var msg string
+	for _, opType := range tr.opTypes() {
+		msg += fmt.Sprintf("%v: %v operations, %.2f ops/s", opType,
+			tr.opCounts[opType], float64(tr.opCounts[opType])/timeSoFar)
+		if sorted := tr.sortedDurations(opType); len(sorted) > 0 {
+			msg += ", latency " + getPercentilesMessage(sorted)
+		}
+		msg += ".\n"
+	}
+	return msg
+}
+
+// reportedSeconds returns the range [first, end) of the seconds of
+// the test whose operation counts are reported. With
+// completeSeconds, the first second is left out, as no operation
+// completes in it until the first latency has passed, and so is
+// the last second if the test ended during it.
+func (tr *TestResult) reportedSeconds() (first, end int) {
+	end = len(tr.secondCount)
+	if !completeSeconds {
+		return 0, end
+	}
+	if !tr.endTime.IsZero() {
+		if whole := int(tr.endTime.Sub(tr.startTime) / time.Second); whole < end {
+			end = whole
+		}
+	}
+	if end < 1 {
+		return 0, 0
+	}
+	return 1, end
+}
+
+// activeSpan is the time a worker was active: from the start of its
+// first operation until it quit.
+type activeSpan struct {
+	start, end time.Time
+}
+
+// secondConcurrency returns the average number of active workers in
+// each second of the test, with -record-concurrency.
+func (tr *TestResult) secondConcurrency() []float64 {
+	end := tr.endTime
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+	seconds := int(math.Ceil(end.Sub(tr.startTime).Seconds()))
+	if seconds < len(tr.secondCount) {
+		seconds = len(tr.secondCount)
+	}
+	active := make([]float64, seconds)
+	for _, span := range tr.activeSpans {
+		if span.start.IsZero() {
+			continue
+		}
+		spanEnd := span.end
+		if spanEnd.IsZero() {
+			spanEnd = end
+		}
+		from := span.start.Sub(tr.startTime).Seconds()
+		to := spanEnd.Sub(tr.startTime).Seconds()
+		for sec := int(math.Max(from, 0)); sec < seconds && float64(sec) < to; sec++ {
+			// the part of the second the worker was active.
+			active[sec] += math.Min(to, float64(sec+1)) - math.Max(from, float64(sec))
+		}
+	}
+	return active
+}
+
+// peakSecond returns the second of the test in which the most
+// operations completed, and the number of operations in it.
+func (tr *TestResult) peakSecond() (sec int, count int64) {
+	first, end := tr.reportedSeconds()
+	for i := first; i < end; i++ {
+		if c := tr.secondCount[i]; c > count {
+			sec, count = i, c
+		}
+	}
+	return sec, count
+}
+
+// activeSeconds returns the time the test has run so far (or in
+// total, once it has ended), excluding paused time.
+func (tr *TestResult) activeSeconds() float64 {
+	now := time.Now().UTC()
+	if !tr.endTime.IsZero() {
+		now = tr.endTime
+	}
+	return (now.Sub(tr.startTime) - loadPauser.totalPaused()).Seconds()
+}
+
+func (tr *TestResult) getTRMessage() string {
+	timeSoFar := tr.activeSeconds()
+	if mode == modeListIncomplete {
+		var avgLatency time.Duration
+		if tr.objectCount > 0 {
+			avgLatency = tr.totalDuration / time.Duration(tr.objectCount)
+		}
+		return fmt.Sprintf("At %.2f: Avg lists/s: %.2f. Avg list latency: %v. Listed %v incomplete uploads in %v lists.\n",
+			timeSoFar, float64(tr.objectCount)/timeSoFar, avgLatency,
+			tr.listedCount, tr.objectCount)
+	}
+	if mode == modeTiny {
+		return fmt.Sprintf("At %.2f: Avg obj/s: %.2f. Uploaded %v objects.\n",
+			timeSoFar, float64(tr.objectCount)/timeSoFar, tr.objectCount)
+	}
+	if mode == modeStat {
+		return fmt.Sprintf("At %.2f: Avg stats/s: %.2f. Completed %v stat requests.\n",
+			timeSoFar, float64(tr.objectCount)/timeSoFar, tr.objectCount)
+	}
+	if mode == modeDelete {
+		return fmt.Sprintf("At %.2f: Avg deletes/s: %.2f. Deleted %v objects.\n",
+			timeSoFar, float64(tr.objectCount)/timeSoFar, tr.objectCount)
+	}
+	if mode == modeGet {
+		return fmt.Sprintf("At %.2f: Avg data b/w: %.2f MiBps. Avg obj/s: %.2f. Data Read: %0.2f MiB in %v objects.\n",
+			timeSoFar, float64(tr.bytesRead)/(timeSoFar*1024*1024), float64(tr.objectCount)/timeSoFar,
+			float64(tr.bytesRead)/float64(1024*1024), tr.objectCount)
+	}
+
+	bandwidthMiBps := float64(tr.bytesWritten) /
+		(timeSoFar * 1024 * 1024)
+	objps := float64(tr.objectCount) / timeSoFar
+
+	totalDataWrittenMiB := float64(tr.bytesWritten) /
+		float64(1024*1024)
+
+	msg := fmt.Sprintf("At %.2f: Avg data b/w: %.2f MiBps. Avg obj/s: %.2f. Data Written: %0.2f MiB in %v objects.",
+		timeSoFar, bandwidthMiBps, objps, totalDataWrittenMiB,
+		tr.objectCount)
+	if mode == modeMixed || tr.bytesRead > 0 {
+		msg = fmt.Sprintf("At %.2f: Avg write b/w: %.2f MiBps. Avg read b/w: %.2f MiBps. Avg ops/s: %.2f. Data Written: %0.2f MiB. Data Read: %0.2f MiB. Completed %v operations.",
+			timeSoFar, bandwidthMiBps,
+			float64(tr.bytesRead)/(timeSoFar*1024*1024), objps,
+			totalDataWrittenMiB, float64(tr.bytesRead)/float64(1024*1024),
+			tr.objectCount)
+	}
+	if abortRate > 0 {
+		msg += fmt.Sprintf(" Abandoned uploads: %v.", tr.abandonedCount)
+	}
+	if tr.skippedCount > 0 {
+		msg += fmt.Sprintf(" Skipped operations on deleted objects: %v.", tr.skippedCount)
+	}
+	if limiter != nil && tr.endTime.IsZero() {
+		limiter.mu.Lock()
+		msg += fmt.Sprintf(" Window: %v of %v.", limiter.window, concurrency)
+		limiter.mu.Unlock()
+	}
+	return msg + "\n"
+}
+
+// countdown waits for d, reporting the remaining time via msgCh
+// every second.
+func countdown(msgCh chan<- string, d time.Duration) {
+	end := time.Now().Add(d)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for remaining := d; remaining > 0; remaining = time.Until(end) {
+		msgCh <- fmt.Sprintf("Starting in %v...\n", remaining.Round(time.Second))
+		if remaining < time.Second {
+			time.Sleep(remaining)
+			break
+		}
+		<-ticker.C
+	}
+}
+
+func printRoutine(msgCh chan string, printerDoneCh chan struct{}) {
+	for msg := range msgCh {
+		fmt.Print(msg)
+	}
+	printerDoneCh <- struct{}{}
+}
+
+// wsGUID is the GUID that a WebSocket handshake key is combined with
+// (RFC 6455).
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsResult is an operation result as sent to live feed clients, and
+// to Kafka.
+type wsResult struct {
+	RunID      string    `json:"runId"`
+	Op         string    `json:"op"`
+	StartTime  time.Time `json:"startTime"`
+	DurationNs int64     `json:"durationNs"`
+	Size       int64     `json:"size"`
+}
+
+// liveFeed streams the result of each operation as a JSON message to
+// the WebSocket clients connected to it. Results are handed to the
+// feed without blocking, and dropped for clients that do not keep
+// up, so that the feed never slows down the result collection.
+type liveFeed struct {
+	listener  net.Listener
+	samplesCh chan []opSample
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+
+	doneCh chan struct{}
+}
+
+// startLiveFeed starts serving the live feed on addr.
+func startLiveFeed(addr string) (*liveFeed, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	feed := &liveFeed{
+		listener:  listener,
+		samplesCh: make(chan []opSample, 100),
+		clients:   make(map[chan []byte]struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go func() {
+		// returns when the listener is closed.
+		_ = http.Serve(listener, http.HandlerFunc(feed.serveClient))
+	}()
+	go feed.broadcast()
+	return feed, nil
+}
+
+// publish hands the samples to the feed, dropping them if the feed
+// is behind.
+func (feed *liveFeed) publish(samples []opSample) {
+	select {
+	case feed.samplesCh <- samples:
+	default:
+	}
+}
+
+// broadcast encodes the published samples and sends them to all
+// clients.
+func (feed *liveFeed) broadcast() {
+	defer close(feed.doneCh)
+	for samples := range feed.samplesCh {
+		for _, sample := range samples {
+			msg, err := json.Marshal(wsResult{
+				RunID:      runID,
+				Op:         sample.opType,
+				StartTime:  sample.startTime,
+				DurationNs: int64(sample.duration),
+				Size:       sample.size,
+			})
+			if err != nil {
+				continue
+			}
+			feed.mu.Lock()
+			for sendCh := range feed.clients {
+				select {
+				case sendCh <- msg:
+				default:
+					// the client is not keeping up.
+				}
+			}
+			feed.mu.Unlock()
+		}
+	}
+}
+
+// close stops the feed and disconnects all clients.
+func (feed *liveFeed) close() {
+	feed.listener.Close()
+	close(feed.samplesCh)
+	<-feed.doneCh
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	for sendCh := range feed.clients {
+		close(sendCh)
+		delete(feed.clients, sendCh)
+	}
+}
+
+// serveClient upgrades the request to a WebSocket connection and
+// sends the feed's messages to it.
+func (feed *liveFeed) serveClient(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	accept := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err = rw.Flush(); err != nil {
+		return
+	}
+
+	sendCh := make(chan []byte, 1000)
+	feed.mu.Lock()
+	feed.clients[sendCh] = struct{}{}
+	feed.mu.Unlock()
+	removeClient := func() {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		if _, ok := feed.clients[sendCh]; ok {
+			delete(feed.clients, sendCh)
+			close(sendCh)
+		}
+	}
+
+	// the client is only expected to close the connection.
+	go func() {
+		_ = readWSFrames(rw.Reader)
+		removeClient()
+	}()
+
+	for msg := range sendCh {
+		if err = writeWSFrame(rw.Writer, 0x1, msg); err == nil {
+			err = rw.Flush()
+		}
+		if err != nil {
+			removeClient()
+			// drain until the channel is closed.
+			for range sendCh {
+			}
+			return
+		}
+	}
+	// the feed is closed.
+	_ = writeWSFrame(rw.Writer, 0x8, nil)
+	_ = rw.Flush()
+}
+
+// writeWSFrame writes an unmasked WebSocket frame with the given
+// opcode, as sent by a server.
+func writeWSFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n < 1<<16:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// wsMaxClientFrame is the longest frame accepted from a live feed
+// client, which only sends control frames of at most 125 bytes (RFC
+// 6455), so that a client cannot make the feed read a frame of any
+// length.
+const wsMaxClientFrame = 1 << 16
+
+// readWSFrames reads and discards WebSocket frames until a close
+// frame is received or reading fails.
+func readWSFrames(r io.Reader) error {
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		opcode := header[0] & 0x0f
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(r, ext); err != nil {
+				return err
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+		if length > wsMaxClientFrame {
+			return fmt.Errorf("WebSocket frame of %v bytes is too long", length)
+		}
+		if header[1]&0x80 != 0 {
+			// skip the masking key.
+			length += 4
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+			return err
+		}
+		if opcode == 0x8 {
+			return nil
+		}
+	}
+}
+
+// settings of publishing operation results to Kafka: the most
+// results sent in one produce request, the longest a result waits
+// for its batch to fill, and the timeout of a request to a broker.
+const (
+	kafkaBatchSize = 1000
+	kafkaLinger    = time.Second
+	kafkaTimeout   = 10 * time.Second
+)
+
+// kafkaWriter sends messages to a Kafka topic, as *kafka.Writer does.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// kafkaProducer publishes the result of each operation as a JSON
+// message to a Kafka topic. Like the live feed, results are handed to
+// it without blocking. Batches that cannot be delivered, e.g. while
+// the brokers are unavailable, are dropped, so that the producer
+// never holds up the test.
+type kafkaProducer struct {
+	topic  string
+	writer kafkaWriter
+
+	samplesCh chan []opSample
+	doneCh    chan struct{}
+
+	// number of results delivered and dropped.
+	sent    int64
+	dropped int64
+
+	// set while batches are dropped, so that an outage is only
+	// reported once.
+	failing bool
+}
+
+// newKafkaWriter returns a writer to topic through the given brokers,
+// that sends each batch uncompressed to the next partition in turn,
+// with acknowledgement from the partition leader only, and does not
+// retry.
+func newKafkaWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.RoundRobin{ChunkSize: kafkaBatchSize},
+		// the producer batches the results itself.
+		BatchSize:    kafkaBatchSize,
+		BatchTimeout: time.Millisecond,
+		ReadTimeout:  kafkaTimeout,
+		WriteTimeout: kafkaTimeout,
+		RequiredAcks: kafka.RequireOne,
+		MaxAttempts:  1,
+	}
+}
+
+// startKafkaProducer starts publishing results to topic through the
+// given brokers.
+func startKafkaProducer(brokers []string, topic string) *kafkaProducer {
+	return startKafkaWriter(newKafkaWriter(brokers, topic), topic)
+}
+
+// startKafkaWriter starts publishing results to topic with writer.
+func startKafkaWriter(writer kafkaWriter, topic string) *kafkaProducer {
+	kp := &kafkaProducer{
+		topic:     topic,
+		writer:    writer,
+		samplesCh: make(chan []opSample, 100),
+		doneCh:    make(chan struct{}),
+	}
+	go kp.run()
+	return kp
+}
+
+// publish hands the samples to the producer, dropping them if it is
+// behind.
+func (kp *kafkaProducer) publish(samples []opSample) {
+	select {
+	case kp.samplesCh <- samples:
+	default:
+		atomic.AddInt64(&kp.dropped, int64(len(samples)))
+	}
+}
+
+// run encodes the published samples and sends them in batches.
+func (kp *kafkaProducer) run() {
+	defer close(kp.doneCh)
+	ticker := time.NewTicker(kafkaLinger)
+	defer ticker.Stop()
+	var batch []kafka.Message
+	for {
+		select {
+		case samples, ok := <-kp.samplesCh:
+			if !ok {
+				if len(batch) > 0 {
+					kp.flush(batch)
+				}
+				if err := kp.writer.Close(); err != nil {
+					fmt.Printf("Closing the writer of Kafka topic %v failed - %v\n", kp.topic, err)
+				}
+				return
+			}
+			for _, sample := range samples {
+				value, err := json.Marshal(wsResult{
+					RunID:      runID,
+					Op:         sample.opType,
+					StartTime:  sample.startTime,
+					DurationNs: int64(sample.duration),
+					Size:       sample.size,
+				})
+				if err != nil {
+					continue
+				}
+				batch = append(batch, kafka.Message{Time: sample.startTime, Value: value})
+				if len(batch) == kafkaBatchSize {
+					kp.flush(batch)
+					batch = nil
+				}
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				kp.flush(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// flush sends the batch, or drops it if that fails.
+func (kp *kafkaProducer) flush(batch []kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	if err := kp.writer.WriteMessages(ctx, batch...); err != nil {
+		atomic.AddInt64(&kp.dropped, int64(len(batch)))
+		if !kp.failing {
+			fmt.Printf("Dropping operation results for Kafka topic %v - %v\n", kp.topic, err)
+			kp.failing = true
+		}
+		return
+	}
+	if kp.failing {
+		fmt.Printf("Publishing operation results to Kafka topic %v again.\n", kp.topic)
+		kp.failing = false
+	}
+	kp.sent += int64(len(batch))
+}
+
+// close sends the remaining results, stops the producer and reports
+// how many results were delivered.
+func (kp *kafkaProducer) close() {
+	close(kp.samplesCh)
+	<-kp.doneCh
+	fmt.Printf("Published %v operation results to Kafka topic %v, dropped %v.\n",
+		kp.sent, kp.topic, atomic.LoadInt64(&kp.dropped))
+}
+
+// upper bounds in seconds of the buckets of the latency histogram.
+var metricsBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5,
+	1, 2.5, 5, 10, 30, 60,
+}
+
+// metricsExemplar is the last operation observed in a bucket of the
+// latency histogram.
+type metricsExemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+// opHistogram is the latency histogram of one operation type. The
+// bucket counts are not cumulative; the last bucket is +Inf.
+type opHistogram struct {
+	counts    []int64
+	exemplars []metricsExemplar
+	count     int64
+	sum       float64
+}
+
+// latencyMetrics is a histogram of the latency of the successful
+// operations of each type, served to Prometheus over HTTP.
+type latencyMetrics struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	byOp map[string]*opHistogram
+}
+
+// startMetrics starts serving the latency histogram on addr.
+func startMetrics(addr string) (*latencyMetrics, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	m := &latencyMetrics{
+		listener: listener,
+		byOp:     make(map[string]*opHistogram),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serve)
+	go func() {
+		// returns when the listener is closed.
+		_ = http.Serve(listener, mux)
+	}()
+	return m, nil
+}
+
+// observe adds the operation to the histogram of its type.
+func (m *latencyMetrics) observe(msg workerMsg) {
+	value := msg.putDuration.Seconds()
+	i := sort.SearchFloat64s(metricsBuckets, value)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.byOp[msg.opType]
+	if !ok {
+		h = &opHistogram{
+			counts:    make([]int64, len(metricsBuckets)+1),
+			exemplars: make([]metricsExemplar, len(metricsBuckets)+1),
+		}
+		m.byOp[msg.opType] = h
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += value
+	if msg.traceID != "" {
+		h.exemplars[i] = metricsExemplar{
+			traceID: msg.traceID,
+			value:   value,
+			time:    msg.putStartTime.Add(msg.putDuration),
+		}
+	}
+}
+
+// serve writes the histogram in the Prometheus text format, or in
+// the OpenMetrics format with exemplars if enabled.
+func (m *latencyMetrics) serve(w http.ResponseWriter, r *http.Request) {
+	if exemplars {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+func (m *latencyMetrics) write(w io.Writer) {
+	const name = "minio_perftest_op_duration_seconds"
+	fmt.Fprintf(w, "# HELP %v Duration of the successful operations.\n", name)
+	fmt.Fprintf(w, "# TYPE %v histogram\n", name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	opTypes := make([]string, 0, len(m.byOp))
+	for opType := range m.byOp {
+		opTypes = append(opTypes, opType)
+	}
+	sort.Strings(opTypes)
+	for _, opType := range opTypes {
+		h := m.byOp[opType]
+		var cumulative int64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(metricsBuckets) {
+				le = strconv.FormatFloat(metricsBuckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%v_bucket{%vop=%q,le=%q} %v", name, metricLabels, opType, le, cumulative)
+			if e := h.exemplars[i]; exemplars && e.traceID != "" {
+				fmt.Fprintf(w, " # {trace_id=%q} %v %.3f", e.traceID,
+					strconv.FormatFloat(e.value, 'g', -1, 64),
+					float64(e.time.UnixNano())/1e9)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%v_count{%vop=%q} %v\n", name, metricLabels, opType, h.count)
+		fmt.Fprintf(w, "%v_sum{%vop=%q} %v\n", name, metricLabels, opType, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	}
+	if exemplars {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+// parseMetricLabels parses a list of static metric labels, e.g.
+// cluster=staging,run="nightly", and returns them formatted as the
+// start of a label set, e.g. cluster="staging",run="nightly",.
+func parseMetricLabels(spec string) (string, error) {
+	if spec == "" {
+		return "", nil
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	seen := make(map[string]bool)
+	var b strings.Builder
+	for _, label := range strings.Split(spec, ",") {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("label %q is not of the form name=value", label)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !metricLabelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return "", fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "op" || name == "le" || seen[name] {
+			return "", fmt.Errorf("label %q is given twice or is used by the metrics", name)
+		}
+		seen[name] = true
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			value = unquoted
+		}
+		fmt.Fprintf(&b, "%v=\"%v\",", name, escaper.Replace(value))
+	}
+	return b.String(), nil
+}
+
+// metricLabelName matches valid Prometheus label names.
+var metricLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// close stops serving the histogram.
+func (m *latencyMetrics) close() {
+	m.listener.Close()
+}
+
+// newTraceID returns a random W3C trace context trace id.
+func newTraceID() string {
+	var b [16]byte
+	_, _ = crand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// newSpanID returns a random W3C trace context span id.
+func newSpanID() string {
+	var b [8]byte
+	_, _ = crand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// isTerminal returns whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progress reports the progress of a bulk phase outside of the
+// measured test, such as an audit or a cleanup, via an async
+// printer. On a terminal a live progress bar is shown, otherwise a
+// progress line is printed periodically.
+type progress struct {
+	name  string
+	total int64
+	start time.Time
+	isTTY bool
+
+	// number of objects done - accessed atomically.
+	done int64
+
+	// names of the parts of the work, e.g. buckets, and the number
+	// of objects done in each - accessed atomically.
+	parts    []string
+	partDone []int64
+
+	msgCh         chan string
+	printerDoneCh chan struct{}
+	stopCh        chan struct{}
+	reportDoneCh  chan struct{}
+}
+
+func startProgress(name string, total int64) *progress {
+	return startPartsProgress(name, total, nil)
+}
+
+// startPartsProgress is like startProgress, but also reports the
+// objects done in each of the given parts, with addPart.
+func startPartsProgress(name string, total int64, parts []string) *progress {
+	p := &progress{
+		name:          name,
+		total:         total,
+		parts:         parts,
+		partDone:      make([]int64, len(parts)),
+		start:         time.Now().UTC(),
+		isTTY:         isTerminal(os.Stdout),
+		msgCh:         make(chan string, 100),
+		printerDoneCh: make(chan struct{}),
+		stopCh:        make(chan struct{}),
+		reportDoneCh:  make(chan struct{}),
+	}
+	go printRoutine(p.msgCh, p.printerDoneCh)
+	go p.report()
+	return p
+}
+
+// add records n more objects as done.
+func (p *progress) add(n int64) {
+	atomic.AddInt64(&p.done, n)
+}
+
+// addPart records n more objects of the i-th part as done.
+func (p *progress) addPart(i int, n int64) {
+	atomic.AddInt64(&p.partDone[i], n)
+	p.add(n)
+}
+
+// getPartsMessage returns the objects done in each part, if any.
+func (p *progress) getPartsMessage() string {
+	if len(p.parts) == 0 {
+		return ""
+	}
+	counts := make([]string, len(p.parts))
+	for i, part := range p.parts {
+		counts[i] = fmt.Sprintf("%v: %v", part, atomic.LoadInt64(&p.partDone[i]))
+	}
+	return " [" + strings.Join(counts, ", ") + "]"
+}
+
+// printf prints a message without garbling the progress bar.
+func (p *progress) printf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if p.isTTY {
+		// clear the progress bar line first.
+		msg = "\r\033[K" + msg
+	}
+	p.msgCh <- msg
+}
+
+func (p *progress) getMessage() string {
+	done := atomic.LoadInt64(&p.done)
+	var rate float64
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = float64(done) / elapsed
+	}
+	if !p.isTTY {
+		return fmt.Sprintf("%v: %v/%v objects done (%.1f objects/s)%v.\n",
+			p.name, done, p.total, rate, p.getPartsMessage())
+	}
+
+	const barWidth = 40
+	filled := barWidth
+	if p.total > 0 && done < p.total {
+		filled = int(done * barWidth / p.total)
+	}
+	return fmt.Sprintf("\r%v [%v%v] %v/%v (%.1f objects/s)%v", p.name,
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		done, p.total, rate, p.getPartsMessage())
+}
+
+func (p *progress) report() {
+	defer close(p.reportDoneCh)
+	interval := 10 * time.Second
+	if p.isTTY {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.msgCh <- p.getMessage()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// finish prints the final progress and stops reporting.
+func (p *progress) finish() {
+	close(p.stopCh)
+	<-p.reportDoneCh
+	msg := p.getMessage()
+	if p.isTTY {
+		msg += "\n"
+	}
+	p.msgCh <- msg
+	close(p.msgCh)
+	<-p.printerDoneCh
+}
+
+// calibrateConcurrency runs a short test at each concurrency level
+// from 1 up to maxConcurrency, doubling it each time, and returns the
+// level at which the throughput saturated: the last level before
+// doubling the workers raised the ops/s by less than
+// autoConcurrencyGain. The bucket is emptied and prepopulated once,
+// before the first level.
+func calibrateConcurrency(objSize int64, maxConcurrency int) (int, error) {
+	// calibration runs do not use the live outputs, pause signal
+	// and start delay of the test.
+	savedDuration, savedDelay := workerDuration, delayStart
+	savedWSAddr, savedMetricsAddr, savedPause := wsAddr, metricsAddr, pauseSignal
+	savedKafkaTopic, savedHealthcheck := kafkaTopic, healthcheck
+	savedParquetFile := parquetFile
+	workerDuration, delayStart = autoConcurrencyStep, 0
+	wsAddr, metricsAddr, pauseSignal = "", "", false
+	kafkaTopic, healthcheck = "", false
+	parquetFile = ""
+	defer func() {
+		workerDuration, delayStart = savedDuration, savedDelay
+		wsAddr, metricsAddr, pauseSignal = savedWSAddr, savedMetricsAddr, savedPause
+		kafkaTopic, healthcheck = savedKafkaTopic, savedHealthcheck
+		parquetFile = savedParquetFile
+		// the counters of the test start from zero.
+		atomic.StoreInt64(&thinkTimeTotal, 0)
+		atomic.StoreInt64(&retryCount, 0)
+		atomic.StoreInt64(&backoffTotal, 0)
+		atomic.StoreInt64(&dnsFailures, 0)
+		atomic.StoreInt64(&injectedErrors, 0)
+		atomic.StoreInt64(&injectedDelays, 0)
+	}()
+
+	var levels []int
+	for c := 1; c < maxConcurrency; c *= 2 {
+		levels = append(levels, c)
+	}
+	levels = append(levels, maxConcurrency)
+
+	best, bestRate := 0, 0.0
+	for _, c := range levels {
+		fmt.Printf("Calibrating with a concurrency of %v for %v...\n", c, autoConcurrencyStep)
+		concurrency = c
+		var err error
+		if workerEndpoints, err = splitWorkers(splitSpec, len(endpoints), c); err != nil {
+			return 0, err
+		}
+		if adaptive {
+			limiter = newAdaptiveLimiter(c)
+		}
+		tr, err := launchTest(objSize)
+		if err != nil {
+			return 0, fmt.Errorf("Calibration with a concurrency of %v failed - %w", c, err)
+		}
+		emptyBucket, prepopulateCount = false, 0
+
+		var rate float64
+		if secs := tr.activeSeconds(); secs > 0 {
+			rate = float64(tr.objectCount) / secs
+		}
+		fmt.Printf("Concurrency %v: %.2f ops/s, p99 latency %v.\n", c, rate,
+			percentile(tr.sortedDurations(""), 99))
+		if best > 0 && rate < bestRate*(1+autoConcurrencyGain) {
+			fmt.Printf("Chose a concurrency of %v (%.2f ops/s): a concurrency of %v changed the ops/s by %.1f%%, less than the %.1f%% required.\n",
+				best, bestRate, c, (rate/bestRate-1)*100, autoConcurrencyGain*100)
+			return best, nil
+		}
+		best, bestRate = c, rate
+	}
+	fmt.Printf("Chose a concurrency of %v (%.2f ops/s): the throughput did not saturate up to the maximum given by -c.\n",
+		best, bestRate)
+	return best, nil
+}
+
+// generatesNames returns whether the operations of the mode name
+// objects from the generated names.
+func generatesNames() bool {
+	switch mode {
+	case modePut, modeProbe, modeMixed, modeAttributes, modeVersions, modePresignedGet,
+		modeDeleteMarkers, modeReadAfterWrite, modeSelect, modeTiny, modeGet, modeDelete, modeStat:
+		return true
+	}
+	return false
+}
+
+func launchTest(objSize int64) (tr TestResult, err error) {
+	if generatesNames() {
+		setMaxObjects(objSize)
+		if err = generateNames(); err != nil {
+			return TestResult{}, err
+		}
+	}
+	if mode == modeVersions {
+		if versionKeys, err = newUniqueNames(versionKeyCount); err != nil {
+			return TestResult{}, err
+		}
+		for _, key := range versionKeys {
+			countKey(nameTruncated(key))
+		}
+	}
+	if pregenNameCount > 0 {
+		if err = pregenerateNames(pregenNameCount); err != nil {
+			return TestResult{}, err
+		}
+	}
+
+	// try to create bucket in case it doesnt exist.
+	session, err := getAWSSession()
+	if err != nil {
+		return TestResult{}, err
+	}
+	s3Client := s3.New(session)
+
+	// ignore errors as it is most likely that the buckets exist.
+	for _, bucket := range buckets {
+		_, _ = s3Client.CreateBucket(&s3.CreateBucketInput{
+			Bucket: aws.String(bucket),
+		})
+	}
+
+	if emptyBucket {
+		removed, err := removeAllObjects(s3Client)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("Emptying bucket %v failed - %w", bucket, err)
+		}
+		fmt.Printf("Removed %v objects from bucket %v.\n", removed, bucket)
+	}
+
+	if prepopulateCount > 0 {
+		written, err := prepopulate(prepopulateCount, objSize)
+		if err != nil {
+			return TestResult{}, err
+		}
+		for i, bucket := range buckets {
+			// the objects are dealt to the buckets in turn.
+			uploads := prepopulateCount / len(buckets)
+			if i < prepopulateCount%len(buckets) {
+				uploads++
+			}
+			fmt.Printf("Prepopulated bucket %v: %v uploads to %v distinct keys.\n", bucket, uploads, written[i])
+		}
+	}
+
+	if mode == modeVersions || mode == modeDeleteMarkers {
+		out, err := s3Client.GetBucketVersioning(&s3.GetBucketVersioningInput{
+			Bucket: aws.String(bucket),
+		})
+		if err != nil {
+			return TestResult{}, fmt.Errorf("GetBucketVersioning Error for bucket %v - %w", bucket, err)
+		}
+		if aws.StringValue(out.Status) != s3.BucketVersioningStatusEnabled {
+			return TestResult{}, fmt.Errorf("The %v mode requires versioning to be enabled on bucket %v", mode, bucket)
+		}
+	}
+
+	if targetKey != "" {
+		if _, err = statObject(s3Client, bucket, targetKey); err != nil {
+			return TestResult{}, fmt.Errorf("Target key %v in bucket %v is not readable - %w", targetKey, bucket, err)
+		}
+	}
+
+	if mode == modeAttributes {
+		if err = checkObjectAttributes(s3Client); err != nil {
+			return TestResult{}, err
+		}
+	}
+
+	if mode == modeSelect {
+		if err = checkSelectSupport(s3Client); err != nil {
+			return TestResult{}, err
+		}
+	}
+
+	if checksumAlgorithm != "" {
+		if err = checkChecksumSupport(s3Client); err != nil {
+			return TestResult{}, err
+		}
+	}
+
+	if mode == modeRestore {
+		keys, err := findTieredObjects(s3Client)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("ListObjectsV2 Error for bucket %v - %w", bucket, err)
+		}
+		if len(keys) == 0 {
+			return TestResult{}, fmt.Errorf("No objects in a cold tier found in bucket %v under prefix %q - the restore mode requires objects transitioned by a lifecycle rule", bucket, restorePrefix)
+		}
+		for _, key := range keys {
+			liveKeys.add(key)
+		}
+		fmt.Printf("Found %v objects in a cold tier to restore.\n", len(keys))
+	}
+
+	if mode == modeGet && targetKey == "" && prepopulateCount == 0 {
+		keys, err := findObjects(s3Client, maxDistinctObjects)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("ListObjectsV2 Error for bucket %v - %w", bucket, err)
+		}
+		if len(keys) == 0 {
+			return TestResult{}, fmt.Errorf("No objects found in bucket %v - the get mode requires -prepopulate or existing objects", bucket)
+		}
+		for _, key := range keys {
+			liveKeys.add(key)
+		}
+		fmt.Printf("Found %v objects to download.\n", len(keys))
+	}
+
+	workerMsgCh := make(chan workerMsg)
+
+	// channels to print asynch.
+	// buffer upto 100 messages
+	printMsgCh := make(chan string, 100)
+	printerDoneCh := make(chan struct{})
+	go printRoutine(printMsgCh, printerDoneCh)
+
+	var feed *liveFeed
+	if wsAddr != "" {
+		if feed, err = startLiveFeed(wsAddr); err != nil {
+			return TestResult{}, fmt.Errorf("Live feed on %v failed - %w", wsAddr, err)
+		}
+		defer feed.close()
+		fmt.Printf("Streaming operation results to WebSocket clients at ws://%v/\n", feed.listener.Addr())
+	}
+
+	var kafka *kafkaProducer
+	if kafkaTopic != "" {
+		kafka = startKafkaProducer(kafkaBrokers, kafkaTopic)
+		defer kafka.close()
+		fmt.Printf("Publishing operation results to Kafka topic %v.\n", kafkaTopic)
+	}
+
+	var parquetOut *parquetStream
+	if parquetFile != "" {
+		if parquetOut, err = startParquetStream(parquetFile); err != nil {
+			return TestResult{}, fmt.Errorf("Parquet file %v failed - %w", parquetFile, err)
+		}
+		defer func() {
+			if perr := parquetOut.close(); perr != nil {
+				fmt.Printf("Error writing %v: %v\n", parquetFile, perr)
+			}
+		}()
+	}
+
+	if metricsAddr != "" {
+		if metrics, err = startMetrics(metricsAddr); err != nil {
+			return TestResult{}, fmt.Errorf("Metrics endpoint on %v failed - %w", metricsAddr, err)
+		}
+		defer metrics.close()
+		fmt.Printf("Serving latency metrics at http://%v/metrics\n", metrics.listener.Addr())
+	}
+
+	pauseStopCh := make(chan struct{})
+	pauseDoneCh := make(chan struct{})
+	if pauseSignal {
+		fmt.Printf("Send SIGUSR1 to process %v to pause or resume the load.\n", os.Getpid())
+		go handlePauseSignal(printMsgCh, pauseStopCh, pauseDoneCh)
+	}
+
+	// quitCh is buffered as some workers may have quit due to
+	// errors when we send the quit signal.
+	quitCh := make(chan struct{}, concurrency)
+
+	// feed object sizes from stdin to the workers.
+	var sizeCh chan int64
+	sizeErrCh := make(chan error, 1)
+	if sizesFromStdin {
+		sizeCh = make(chan int64, concurrency)
+		go readSizes(os.Stdin, sizeCh, sizeErrCh)
+	}
+
+	// seed the sampling from the run seed so that it is
+	// reproducible.
+	tr.sampleRand = rand.New(rand.NewSource(randomSeed))
+	tr.manifest = make(map[string]manifestEntry)
+	tr.opCounts = make(map[string]int64)
+	tr.conflicts = make(map[string]int64)
+	tr.prefixes = make(map[string]*prefixStats)
+	tr.endpointStats = make([]endpointStats, len(endpoints))
+	if recordConcurrency {
+		tr.activeSpans = make([]activeSpan, concurrency)
+	}
+
+	if delayStart > 0 {
+		countdown(printMsgCh, delayStart)
+	}
+
+	// Start workers
+	tr.startTime = time.Now().UTC()
+	if conns != nil {
+		conns.startTest(tr.startTime)
+	}
+	limiterStopCh := make(chan struct{})
+	if limiter != nil {
+		go limiter.run(limiterStopCh)
+	}
+	var hc *healthchecker
+	if healthcheck {
+		if hc, err = startHealthchecker(); err != nil {
+			return TestResult{}, fmt.Errorf("Health-check probe failed - %w", err)
+		}
+	}
+	// with more than one collector, each collector combines the
+	// results of a shard of the workers.
+	numCollectors := collectors
+	if numCollectors > concurrency {
+		numCollectors = concurrency
+	}
+	var shardChs []chan workerMsg
+	if numCollectors > 1 {
+		shardChs = make([]chan workerMsg, numCollectors)
+		for i := range shardChs {
+			shardChs[i] = make(chan workerMsg)
+			numWorkers := (concurrency - i + numCollectors - 1) / numCollectors
+			go collectShard(shardChs[i], numWorkers, workerMsgCh)
+		}
+	}
+	for i := 0; i < concurrency; i++ {
+		msgCh := workerMsgCh
+		if shardChs != nil {
+			msgCh = shardChs[i%numCollectors]
+		}
+		go workerLoop(i, objSize, sizeCh, tr.startTime, msgCh, quitCh)
+	}
+
+	// collect results and wait for workers to quit.
+	numWorkersQuit := 0
+	isQuitting := false
+	quitWorkers := func() {
+		if !isQuitting {
+			isQuitting = true
+			for i := 0; i < concurrency; i++ {
+				quitCh <- struct{}{}
+			}
+		}
+	}
+
+	// with a synchronized stop, the collector checks whether the
+	// test is done.
+	var stopCheck <-chan time.Time
+	if syncStop && sizeCh == nil && mode != modeVersions && mode != modeRestore && mode != modeDelete &&
+		pregenNames == nil && iterationsPerWorker == 0 {
+		stopTicker := time.NewTicker(statsFlushInterval)
+		defer stopTicker.Stop()
+		stopCheck = stopTicker.C
+	}
+
+	// stop the test at the maximum run time, whatever the state
+	// of the workers.
+	var maxRuntimeCh chan struct{}
+	if maxRuntime > 0 {
+		maxRuntimeCh = make(chan struct{})
+		maxRuntimeTimer := time.AfterFunc(maxRuntime, func() {
+			close(maxRuntimeCh)
+		})
+		defer maxRuntimeTimer.Stop()
+	}
+
+	// with -hang-dump-after, a watchdog dumps the goroutine stacks
+	// once no operation has completed for that long, and again
+	// after each further stall.
+	var hangCheck <-chan time.Time
+	lastProgress := time.Now()
+	hangDumped := false
+	hangDumps := 0
+	if hangDumpAfter > 0 {
+		hangTicker := time.NewTicker(time.Second)
+		defer hangTicker.Stop()
+		hangCheck = hangTicker.C
+	}
+
+	eachInterval := time.After(time.Second * 10)
+	var hadUploadError error
+	// number of operations that failed since the last success.
+	consecutiveErrors := 0
+	for numWorkersQuit < concurrency {
+		select {
+		case wMsg := <-workerMsgCh:
+			if (wMsg.stats != nil && !wMsg.stats.isEmpty()) || wMsg.opErr != nil {
+				lastProgress = time.Now()
+				hangDumped = false
+			}
+			if wMsg.stats != nil {
+				tr.addStats(wMsg.stats)
+				if feed != nil {
+					feed.publish(wMsg.stats.samples)
+				}
+				if kafka != nil {
+					kafka.publish(wMsg.stats.samples)
+				}
+				if parquetOut != nil {
+					parquetOut.write(wMsg.stats.samples, true)
+					parquetOut.write(wMsg.stats.failed, false)
+				}
+				if wMsg.stats.opCount > 0 {
+					consecutiveErrors = 0
+				}
+			}
+			if wMsg.opErr != nil && !isQuitting {
+				if recordErrorLatency {
+					tr.errorLatencies = append(tr.errorLatencies, wMsg.errDuration)
+				}
+				consecutiveErrors++
+				if isInjectedFault(wMsg.opErr) {
+					tr.injectedErrorCount++
+				} else {
+					tr.realErrorCount++
+				}
+				if consecutiveErrors >= maxConsecutiveErrors {
+					fmt.Printf("%v operations in a row errored, the last with \"%v\" - aborting test!\n",
+						consecutiveErrors, wMsg.opErr)
+					hadUploadError = fmt.Errorf("%v consecutive operations failed - %w", consecutiveErrors, wMsg.opErr)
+					quitWorkers()
+				} else {
+					printMsgCh <- fmt.Sprintf("An operation errored with \"%v\" (%v of %v consecutive errors allowed).\n",
+						wMsg.opErr, consecutiveErrors, maxConsecutiveErrors-1)
+				}
+			}
+			switch {
+			case wMsg.exitingErr == errWorkerSucc:
+				tr.recordWorkerDone(time.Now().UTC())
+				numWorkersQuit++
+			case wMsg.exitingErr == errWorkerQuit:
+				numWorkersQuit++
+			case wMsg.exitingErr != nil:
+				if class := errorClass(wMsg.exitingErr); class != "" {
+					fmt.Printf("An upload attempt errored (%v) with \"%v\" - aborting test!\n", class, wMsg.exitingErr)
+				} else {
+					fmt.Printf("An upload attempt errored with \"%v\" - aborting test!\n", wMsg.exitingErr)
+				}
+				hadUploadError = wMsg.exitingErr
+				if isInjectedFault(wMsg.exitingErr) {
+					tr.injectedErrorCount++
+				} else {
+					tr.realErrorCount++
+				}
+				numWorkersQuit++
+				quitWorkers()
+			}
+
+		// stop all workers together once the test duration has
+		// passed (excluding paused time and the average think
+		// time of the workers) and enough operations are done.
+		case <-stopCheck:
+			activeTime := time.Since(tr.startTime) - loadPauser.totalPaused() -
+				time.Duration(atomic.LoadInt64(&thinkTimeTotal))/time.Duration(concurrency)
+			if activeTime >= workerDuration &&
+				tr.objectCount >= int64(minUploadCount*concurrency) {
+				quitWorkers()
+				stopCheck = nil
+			}
+
+		case <-hangCheck:
+			if loadPauser.isPaused() {
+				lastProgress = time.Now()
+			}
+			if !hangDumped && time.Since(lastProgress) >= hangDumpAfter {
+				hangDumped = true
+				hangDumps++
+				fileName, err := writeHangDump(hangDumps)
+				if err != nil {
+					printMsgCh <- fmt.Sprintf("No operation completed for %v - writing the goroutine stacks failed: %v\n",
+						hangDumpAfter, err)
+				} else {
+					printMsgCh <- fmt.Sprintf("No operation completed for %v - wrote the goroutine stacks to %v\n",
+						hangDumpAfter, fileName)
+				}
+			}
+
+		case <-maxRuntimeCh:
+			printMsgCh <- fmt.Sprintf("Maximum run time of %v reached - stopping test.\n", maxRuntime)
+			quitWorkers()
+			maxRuntimeCh = nil
+
+		// print messages about the running test each second.
+		case <-eachInterval:
+			// print via a separate go routine so as to
+			// not block the for loop for printing.
+			printMsgCh <- tr.getTRMessage()
+			printMsgCh <- tr.getEndpointMessage(false)
+			eachInterval = time.After(time.Second * 10)
+		}
+	}
+
+	tr.endTime = time.Now().UTC()
+	close(limiterStopCh)
+	if hc != nil {
+		tr.healthchecks = hc.stop()
+	}
+	if limiter != nil {
+		limiter.mu.Lock()
+		tr.adaptive = adaptiveSummary{
+			Decreases:    limiter.decreases,
+			MinWindow:    limiter.minWindow,
+			FinalWindow:  limiter.window,
+			SecondWindow: append([]int(nil), limiter.secondWindow...),
+		}
+		limiter.mu.Unlock()
+	}
+	if conns != nil {
+		conns.mu.Lock()
+		tr.newConns, tr.reusedConns = conns.newConns, conns.reusedConns
+		tr.secondNewConns = append([]int64(nil), conns.secondNew...)
+		conns.mu.Unlock()
+	}
+
+	// Close and confirm the printing channel exits.
+	// Stop pause handling before closing the printing channel it
+	// uses.
+	close(pauseStopCh)
+	if pauseSignal {
+		<-pauseDoneCh
+	}
+	close(printMsgCh)
+	<-printerDoneCh
+
+	if hadUploadError == nil {
+		select {
+		case hadUploadError = <-sizeErrCh:
+		default:
+		}
+	}
+
+	return tr, hadUploadError
+}
+
+// latencySummary summarizes operation latencies in nanoseconds.
+type latencySummary struct {
+	Samples int   `json:"samples"`
+	Min     int64 `json:"minNs"`
+	P50     int64 `json:"p50Ns"`
+	P90     int64 `json:"p90Ns"`
+	P99     int64 `json:"p99Ns"`
+	Max     int64 `json:"maxNs"`
+
+	// the percentiles given by -percentiles, by name.
+	Percentiles map[string]int64 `json:"percentilesNs,omitempty"`
+}
+
+// newLatencySummary returns the summary of the sorted latencies.
+func newLatencySummary(sorted []time.Duration) latencySummary {
+	if len(sorted) == 0 {
+		return latencySummary{}
+	}
+	ls := latencySummary{
+		Samples:     len(sorted),
+		Min:         int64(sorted[0]),
+		P50:         int64(percentile(sorted, 50)),
+		P90:         int64(percentile(sorted, 90)),
+		P99:         int64(percentile(sorted, 99)),
+		Max:         int64(sorted[len(sorted)-1]),
+		Percentiles: make(map[string]int64),
+	}
+	for _, p := range latencyPercentiles {
+		ls.Percentiles[percentileName(p)] = int64(percentile(sorted, p))
+	}
+	return ls
+}
+
+// rateSummary summarizes per-object transfer rates in MiB/s.
+type rateSummary struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"minMiBps"`
+	P10     float64 `json:"p10MiBps"`
+	P50     float64 `json:"p50MiBps"`
+	P90     float64 `json:"p90MiBps"`
+	Max     float64 `json:"maxMiBps"`
+}
+
+// endpointSummary is the summary of the operations sent to one
+// endpoint.
+type endpointSummary struct {
+	Endpoint        string         `json:"endpoint"`
+	Workers         int            `json:"workers"`
+	OpCount         int64          `json:"opCount"`
+	OpsPerSec       float64        `json:"opsPerSec"`
+	WriteMiBps      float64        `json:"writeMiBps"`
+	ReadMiBps       float64        `json:"readMiBps"`
+	Latency         latencySummary `json:"latency"`
+	AvgLatencyNanos int64          `json:"avgLatencyNs"`
+}
+
+// endpointSummaries returns the summary of each endpoint. The
+// latency percentiles are only computed if withLatency is set, as
+// they need the samples to be sorted.
+func (tr *TestResult) endpointSummaries(withLatency bool) []endpointSummary {
+	timeSoFar := tr.activeSeconds()
+	sums := make([]endpointSummary, len(tr.endpointStats))
+	for i, es := range tr.endpointStats {
+		sums[i] = endpointSummary{
+			Endpoint: endpoints[i].String(),
+			OpCount:  es.opCount,
+		}
+		if timeSoFar > 0 {
+			sums[i].OpsPerSec = float64(es.opCount) / timeSoFar
+			sums[i].WriteMiBps = float64(es.bytesWritten) / (timeSoFar * 1024 * 1024)
+			sums[i].ReadMiBps = float64(es.bytesRead) / (timeSoFar * 1024 * 1024)
+		}
+		if es.opCount > 0 {
+			sums[i].AvgLatencyNanos = int64(es.totalDuration) / es.opCount
+		}
+	}
+	for _, ep := range workerEndpoints {
+		sums[ep].Workers++
+	}
+	if endpointsWeighted() {
+		// each worker picks the endpoint of each operation.
+		for i := range sums {
+			sums[i].Workers = len(workerEndpoints)
+		}
+	}
+	if withLatency {
+		byEndpoint := make([][]time.Duration, len(sums))
+		for _, sample := range tr.samples {
+			byEndpoint[sample.endpoint] = append(byEndpoint[sample.endpoint], sample.duration)
+		}
+		for i, sorted := range byEndpoint {
+			sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+			sums[i].Latency = newLatencySummary(sorted)
+		}
+	}
+	return sums
+}
+
+// getEndpointMessage returns a table comparing the operations sent
+// to each endpoint, if there is more than one. The final table
+// includes the latency percentiles.
+func (tr *TestResult) getEndpointMessage(final bool) string {
+	if len(tr.endpointStats) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "Endpoint\tWorkers\tOps\tOps/s\tWrite MiB/s\tRead MiB/s\tAvg latency")
+	if final {
+		for _, p := range latencyPercentiles {
+			fmt.Fprintf(tw, "\t%v", percentileName(p))
+		}
+	}
+	fmt.Fprintln(tw)
+	for _, sum := range tr.endpointSummaries(final) {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.2f\t%.2f\t%.2f\t%v", sum.Endpoint, sum.Workers,
+			sum.OpCount, sum.OpsPerSec, sum.WriteMiBps, sum.ReadMiBps,
+			time.Duration(sum.AvgLatencyNanos))
+		if final {
+			for _, p := range latencyPercentiles {
+				fmt.Fprintf(tw, "\t%v", time.Duration(sum.Latency.Percentiles[percentileName(p)]))
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// selectSummary is the number of bytes scanned, processed and
+// returned by the queries in select mode.
+type selectSummary struct {
+	BytesScanned   int64 `json:"bytesScanned"`
+	BytesProcessed int64 `json:"bytesProcessed"`
+	BytesReturned  int64 `json:"bytesReturned"`
+}
+
+// overwriteSummary is the summary of the uploads that created new
+// objects and of those that overwrote existing ones.
+type overwriteSummary struct {
+	Creates          int64          `json:"creates"`
+	Overwrites       int64          `json:"overwrites"`
+	CreateLatency    latencySummary `json:"createLatency"`
+	OverwriteLatency latencySummary `json:"overwriteLatency"`
+}
+
+// opSummary is the summary of the operations of one type.
+type opSummary struct {
+	Count     int64          `json:"count"`
+	OpsPerSec float64        `json:"opsPerSec"`
+	Latency   latencySummary `json:"latency"`
+}
+
+// summary is the summary of a test, as written to the JSON summary
+// file.
+type summary struct {
+	RunID           string                  `json:"runId"`
+	Mode            string                  `json:"mode"`
+	Endpoint        string                  `json:"endpoint"`
+	Bucket          string                  `json:"bucket"`
+	Concurrency     int                     `json:"concurrency"`
+	TCPNoDelay      bool                    `json:"tcpNoDelay"`
+	StartTime       time.Time               `json:"startTime"`
+	DurationSecs    float64                 `json:"durationSecs"`
+	ObjectCount     int64                   `json:"objectCount"`
+	BytesWritten    int64                   `json:"bytesWritten"`
+	BytesRead       int64                   `json:"bytesRead,omitempty"`
+	ThroughputMiBps float64                 `json:"throughputMiBps"`
+	OpsPerSec       float64                 `json:"opsPerSec"`
+	AbandonedCount  int64                   `json:"abandonedCount,omitempty"`
+	SkippedCount    int64                   `json:"skippedCount,omitempty"`
+	Conflicts       map[string]int64        `json:"conflicts,omitempty"`
+	Prefixes        map[string]*prefixStats `json:"prefixes,omitempty"`
+	VersionLatency  []versionBucket         `json:"versionLatency,omitempty"`
+	ListedCount     int64                   `json:"listedCount,omitempty"`
+	Latency         latencySummary          `json:"latency"`
+
+	// distribution of the per-object transfer rates of uploads and
+	// downloads.
+	TransferRate *rateSummary `json:"transferRate,omitempty"`
+
+	// summaries of each operation type.
+	Operations map[string]opSummary `json:"operations"`
+
+	// summaries of each endpoint, if there is more than one.
+	Endpoints []endpointSummary `json:"endpoints,omitempty"`
+
+	// connections requests were sent on, with -conn-stats.
+	Connections *connSummary `json:"connections,omitempty"`
+
+	// window of operations in flight, with -adaptive.
+	Adaptive *adaptiveSummary `json:"adaptive,omitempty"`
+
+	// latencies of the health-check probe, with -healthcheck.
+	Healthcheck *healthcheckSummary `json:"healthcheck,omitempty"`
+
+	// server processing times, if the server sent Server-Timing
+	// headers.
+	ServerTiming *serverTimingSummary `json:"serverTiming,omitempty"`
+
+	// latencies of the steps of multipart uploads, with
+	// -manual-multipart.
+	Multipart *multipartSummary `json:"multipart,omitempty"`
+
+	// latencies of initiating restores in restore mode, while the
+	// latencies of the restore operations last until the objects
+	// are readable.
+	RestoreInitLatency *latencySummary `json:"restoreInitLatency,omitempty"`
+
+	// delays from the end of uploads until the objects were visible,
+	// in read-after-write mode.
+	VisibilityDelay *latencySummary `json:"visibilityDelay,omitempty"`
+
+	// bytes scanned, processed and returned by the queries in
+	// select mode.
+	Select *selectSummary `json:"select,omitempty"`
+
+	// uploads that created and overwrote objects, with
+	// -overwrite-ratio.
+	Overwrites *overwriteSummary `json:"overwrites,omitempty"`
+
+	// latencies of the failed operations, with -record-error-latency,
+	// separate from the latencies of the successful ones.
+	ErrorLatency *latencySummary `json:"errorLatency,omitempty"`
+
+	// average time taken to presign a URL in presigned-get mode.
+	AvgPresignNs int64 `json:"avgPresignNs,omitempty"`
+
+	// average time taken to compute the checksum of an upload, with
+	// -checksum.
+	AvgChecksumNs int64 `json:"avgChecksumNs,omitempty"`
+
+	// average time spent generating the content of an upload, and
+	// the fraction of the upload latencies it took, with
+	// -measure-generation.
+	AvgGenerationNs    int64   `json:"avgGenerationNs,omitempty"`
+	GenerationFraction float64 `json:"generationFraction,omitempty"`
+
+	// retries of requests by the SDK, and the time spent in backoff
+	// before them.
+	RetryCount int64 `json:"retryCount"`
+	BackoffNs  int64 `json:"backoffNs"`
+
+	// request attempts that failed to resolve the endpoint.
+	DNSFailures int64 `json:"dnsFailures,omitempty"`
+
+	// number of the distinct keys generated with -key-cardinality
+	// that were used.
+	DistinctKeys int `json:"distinctKeys,omitempty"`
+
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// getSummary returns the summary of the test. testErr is the error
+// the test quit with, if any.
+func (tr *TestResult) getSummary(testErr error) summary {
+	sum := summary{
+		RunID:          runID,
+		Mode:           mode,
+		Endpoint:       endpoint,
+		Bucket:         strings.Join(buckets, ","),
+		Concurrency:    concurrency,
+		TCPNoDelay:     tcpNoDelay,
+		StartTime:      tr.startTime,
+		ObjectCount:    tr.objectCount,
+		BytesWritten:   tr.bytesWritten,
+		BytesRead:      tr.bytesRead,
+		AbandonedCount: tr.abandonedCount,
+		SkippedCount:   tr.skippedCount,
+		Conflicts:      tr.conflicts,
+		Prefixes:       tr.prefixes,
+		ListedCount:    tr.listedCount,
+	}
+	if testErr != nil {
+		sum.Error = testErr.Error()
+		sum.ErrorClass = errorClass(testErr)
+	}
+	if sum.DurationSecs = tr.activeSeconds(); sum.DurationSecs > 0 {
+		sum.ThroughputMiBps = float64(tr.bytesWritten) / (sum.DurationSecs * 1024 * 1024)
+		sum.OpsPerSec = float64(tr.objectCount) / sum.DurationSecs
+	}
+	sum.Latency = newLatencySummary(tr.sortedDurations(""))
+	if mode == modeVersions {
+		sum.VersionLatency = tr.versionBuckets()
+	}
+	if recordErrorLatency && len(tr.errorLatencies) > 0 {
+		errorLatency := newLatencySummary(sortDurations(tr.errorLatencies))
+		sum.ErrorLatency = &errorLatency
+	}
+	if mode == modeSelect {
+		sum.Select = &selectSummary{
+			BytesScanned:   tr.selectStats.scanned,
+			BytesProcessed: tr.selectStats.processed,
+			BytesReturned:  tr.selectStats.returned,
+		}
+	}
+	if overwriteRatio > 0 {
+		creates, overwrites := tr.overwriteDurations()
+		sum.Overwrites = &overwriteSummary{
+			Creates:          tr.opCounts[opPut] - tr.overwriteCount,
+			Overwrites:       tr.overwriteCount,
+			CreateLatency:    newLatencySummary(creates),
+			OverwriteLatency: newLatencySummary(overwrites),
+		}
+	}
+	if mode == modeReadAfterWrite && len(tr.visibilityDelays) > 0 {
+		visibility := newLatencySummary(sortDurations(tr.visibilityDelays))
+		sum.VisibilityDelay = &visibility
+	}
+	if mode == modeRestore && len(tr.restoreInits) > 0 {
+		initLatency := newLatencySummary(sortDurations(tr.restoreInits))
+		sum.RestoreInitLatency = &initLatency
+	}
+	if sorted := tr.sortedRates(); len(sorted) > 0 {
+		sum.TransferRate = &rateSummary{
+			Samples: len(sorted),
+			Min:     sorted[0],
+			P10:     ratePercentile(sorted, 10),
+			P50:     ratePercentile(sorted, 50),
+			P90:     ratePercentile(sorted, 90),
+			Max:     sorted[len(sorted)-1],
+		}
+	}
+	sum.Operations = make(map[string]opSummary)
+	for _, opType := range tr.opTypes() {
+		op := opSummary{
+			Count:   tr.opCounts[opType],
+			Latency: newLatencySummary(tr.sortedDurations(opType)),
+		}
+		if sum.DurationSecs > 0 {
+			op.OpsPerSec = float64(op.Count) / sum.DurationSecs
+		}
+		sum.Operations[opType] = op
+	}
+	if len(tr.endpointStats) > 1 {
+		sum.Endpoints = tr.endpointSummaries(true)
+	}
+	if manualMultipart && len(tr.multipart.create) > 0 {
+		sum.Multipart = &multipartSummary{
+			Create:   newLatencySummary(sortDurations(tr.multipart.create)),
+			Part:     newLatencySummary(sortDurations(tr.multipart.parts)),
+			Complete: newLatencySummary(sortDurations(tr.multipart.complete)),
+		}
+	}
+	if mode == modePresignedGet && tr.objectCount > 0 {
+		sum.AvgPresignNs = int64(tr.signDuration) / tr.objectCount
+	}
+	if uploads := tr.opCounts[opPut]; checksumAlgorithm != "" && uploads > 0 {
+		sum.AvgChecksumNs = int64(tr.checksumDuration) / uploads
+	}
+	if uploads := tr.opCounts[opPut]; measureGeneration && uploads > 0 && tr.genUploadDuration > 0 {
+		sum.AvgGenerationNs = int64(tr.genDuration) / uploads
+		sum.GenerationFraction = float64(tr.genDuration) / float64(tr.genUploadDuration)
+	}
+	sum.RetryCount = atomic.LoadInt64(&retryCount)
+	sum.BackoffNs = atomic.LoadInt64(&backoffTotal)
+	sum.DNSFailures = atomic.LoadInt64(&dnsFailures)
+	if keyCardinality > 0 {
+		sum.DistinctKeys = distinctKeysUsed()
+	}
+	if limiter != nil {
+		sum.Adaptive = &tr.adaptive
+	}
+	if healthcheck {
+		latencies, failed := tr.healthcheckLatencies()
+		sum.Healthcheck = &healthcheckSummary{
+			Latency: newLatencySummary(latencies),
+			Failed:  failed,
+		}
+	}
+	sum.ServerTiming = tr.serverTiming.summary()
+	if conns != nil {
+		sum.Connections = &connSummary{New: tr.newConns, Reused: tr.reusedConns}
+		if sum.DurationSecs > 0 {
+			sum.Connections.NewPerSec = float64(tr.newConns) / sum.DurationSecs
+		}
+	}
+	return sum
+}
+
+func writeJSONSummary(w io.Writer, sum summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sum)
+}
+
+// summary formats
+const (
+	// plain-text messages
+	summaryText = "text"
+
+	// GitHub-flavored Markdown tables
+	summaryMarkdown = "markdown"
+)
+
+// writeMarkdownSummary writes the summary as GitHub-flavored Markdown
+// tables: the overall metrics, then the operations of each type and
+// the endpoints, if there is more than one.
+func writeMarkdownSummary(w io.Writer, sum summary) error {
+	b := bufio.NewWriter(w)
+	row := func(metric string, value interface{}) {
+		fmt.Fprintf(b, "| %v | %v |\n", metric, value)
+	}
+	fmt.Fprintln(b, "| Metric | Value |")
+	fmt.Fprintln(b, "| --- | --- |")
+	row("Run ID", sum.RunID)
+	row("Mode", sum.Mode)
+	row("Endpoint", sum.Endpoint)
+	row("Bucket", sum.Bucket)
+	row("Concurrency", sum.Concurrency)
+	row("Duration", fmt.Sprintf("%.2fs", sum.DurationSecs))
+	row("Operations", sum.ObjectCount)
+	row("Ops/s", fmt.Sprintf("%.2f", sum.OpsPerSec))
+	row("Bytes written", sum.BytesWritten)
+	if sum.BytesRead > 0 {
+		row("Bytes read", sum.BytesRead)
+	}
+	row("Write throughput", fmt.Sprintf("%.2f MiB/s", sum.ThroughputMiBps))
+	row("Min latency", time.Duration(sum.Latency.Min))
+	for _, p := range latencyPercentiles {
+		name := percentileName(p)
+		row(name+" latency", time.Duration(sum.Latency.Percentiles[name]))
+	}
+	row("Max latency", time.Duration(sum.Latency.Max))
+	row("Retries", sum.RetryCount)
+	if sum.Error != "" {
+		row("Error", strings.ReplaceAll(sum.Error, "|", "\\|"))
+	}
+
+	if len(sum.Operations) > 1 {
+		opTypes := make([]string, 0, len(sum.Operations))
+		for opType := range sum.Operations {
+			opTypes = append(opTypes, opType)
+		}
+		sort.Strings(opTypes)
+		fmt.Fprint(b, "\n| Operation | Count | Ops/s")
+		for _, p := range latencyPercentiles {
+			fmt.Fprintf(b, " | %v", percentileName(p))
+		}
+		fmt.Fprintln(b, " | Max |")
+		fmt.Fprint(b, "| --- | ---: | ---:")
+		for range latencyPercentiles {
+			fmt.Fprint(b, " | ---:")
+		}
+		fmt.Fprintln(b, " | ---: |")
+		for _, opType := range opTypes {
+			op := sum.Operations[opType]
+			fmt.Fprintf(b, "| %v | %v | %.2f", opType, op.Count, op.OpsPerSec)
+			for _, p := range latencyPercentiles {
+				fmt.Fprintf(b, " | %v", time.Duration(op.Latency.Percentiles[percentileName(p)]))
+			}
+			fmt.Fprintf(b, " | %v |\n", time.Duration(op.Latency.Max))
+		}
+	}
+
+	if len(sum.Endpoints) > 0 {
+		fmt.Fprint(b, "\n| Endpoint | Workers | Ops | Ops/s | Write MiB/s | Read MiB/s | Avg latency")
+		for _, p := range latencyPercentiles {
+			fmt.Fprintf(b, " | %v", percentileName(p))
+		}
+		fmt.Fprintln(b, " |")
+		fmt.Fprint(b, "| --- | ---: | ---: | ---: | ---: | ---: | ---:")
+		for range latencyPercentiles {
+			fmt.Fprint(b, " | ---:")
+		}
+		fmt.Fprintln(b, " |")
+		for _, ep := range sum.Endpoints {
+			fmt.Fprintf(b, "| %v | %v | %v | %.2f | %.2f | %.2f | %v", ep.Endpoint, ep.Workers,
+				ep.OpCount, ep.OpsPerSec, ep.WriteMiBps, ep.ReadMiBps, time.Duration(ep.AvgLatencyNanos))
+			for _, p := range latencyPercentiles {
+				fmt.Fprintf(b, " | %v", time.Duration(ep.Latency.Percentiles[percentileName(p)]))
+			}
+			fmt.Fprintln(b, " |")
+		}
+	}
+	return b.Flush()
+}
+
+// postWebhook posts the summary of the test as JSON to the given
+// URL.
+func postWebhook(webhookURL string, sum summary) error {
+	var b bytes.Buffer
+	if err := writeJSONSummary(&b, sum); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, "application/json", &b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	return nil
+}
+
+// sampleOrder returns the indices of the samples ordered by start
+// time.
+func (tr *TestResult) sampleOrder() []int {
+	order := make([]int, len(tr.samples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return tr.samples[order[i]].startTime.Before(tr.samples[order[j]].startTime)
+	})
+	return order
+}
+
+// CSV time formats
+const (
+	// Unix time in nanoseconds
+	timeFormatNano = "nano"
+
+	// Unix time in seconds, with a fractional part
+	timeFormatUnix = "unix"
+
+	// RFC 3339 time with nanoseconds
+	timeFormatRFC3339 = "rfc3339"
+)
+
+// csvTimeColumn returns the CSV column name of the start time.
+func csvTimeColumn() string {
+	switch timeFormat {
+	case timeFormatUnix:
+		return "start_time_unix"
+	case timeFormatRFC3339:
+		return "start_time"
+	default:
+		return "start_time_ns"
+	}
+}
+
+// formatCSVTime formats t according to timeFormat.
+func formatCSVTime(t time.Time) string {
+	switch timeFormat {
+	case timeFormatUnix:
+		return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+	case timeFormatRFC3339:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+}
+
+// csvColumns returns the header of the CSV output files. With
+// -measure-generation, the time spent generating the content of
+// each upload is added as the last column.
+func csvColumns() []string {
+	columns := []string{csvTimeColumn(), "op", "duration_ns", "size"}
+	if measureGeneration {
+		columns = append(columns, "generation_ns")
+	}
+	return columns
+}
+
+// writeCSVComment writes a comment line to a CSV file with
+// -csv-comments. Comments are left out by default, as most CSV
+// readers do not skip them.
+func writeCSVComment(w io.Writer, format string, a ...interface{}) error {
+	if !csvComments {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "# "+format+"\n", a...)
+	return err
+}
+
+// writeCSVOutputFile writes a CSV record of each operation sample,
+// preceded with -csv-comments by a comment line with the run ID.
+func writeCSVOutputFile(w io.Writer, tr *TestResult) error {
+	if err := writeCSVComment(w, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	// with a sample rate, each operation is written with that
+	// probability, picked reproducibly from the run seed.
+	var sampleRand *rand.Rand
+	if csvSampleRate < 1 {
+		sampleRand = rand.New(rand.NewSource(randomSeed))
+		if err := writeCSVComment(w, "random sample of %v of the operations", csvSampleRate); err != nil {
+			return err
+		}
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns()); err != nil {
+		return err
+	}
+	for _, i := range tr.sampleOrder() {
+		if sampleRand != nil && sampleRand.Float64() >= csvSampleRate {
+			continue
+		}
+		record := []string{
+			formatCSVTime(tr.samples[i].startTime),
+			tr.samples[i].opType,
+			strconv.FormatInt(int64(tr.samples[i].duration), 10),
+			strconv.FormatInt(tr.samples[i].size, 10),
+		}
+		if measureGeneration {
+			record = append(record, strconv.FormatInt(int64(tr.samples[i].genDuration), 10))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// number of rows of each row group of the Parquet file, the rows
+// that are buffered before they are written.
+const parquetRowGroupRows = 1 << 20
+
+// parquetRow is the Parquet record of an operation.
+type parquetRow struct {
+	StartTime  time.Time `parquet:"start_time,timestamp(nanosecond)"`
+	Op         string    `parquet:"op"`
+	DurationNs int64     `parquet:"duration_ns"`
+	Size       int64     `parquet:"size"`
+	WorkerID   int32     `parquet:"worker_id"`
+	Success    bool      `parquet:"success"`
+}
+
+// parquetStream writes a row for each operation to a Parquet file
+// while the test runs, as the collector receives the results of the
+// workers, so that only the rows of the current row group are kept
+// in memory.
+type parquetStream struct {
+	file *os.File
+	bw   *bufio.Writer
+	pw   *parquet.GenericWriter[parquetRow]
+	rows []parquetRow
+
+	// the first error writing the file, after which no more rows
+	// are written.
+	err error
+}
+
+func startParquetStream(fileName string) (*parquetStream, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	ps := &parquetStream{file: file, bw: bufio.NewWriter(file)}
+	ps.pw = parquet.NewGenericWriter[parquetRow](ps.bw,
+		parquet.MaxRowsPerRowGroup(parquetRowGroupRows),
+		parquet.KeyValueMetadata("minio-perftest.runId", runID))
+	return ps, nil
+}
+
+// write appends a row for each of the operations.
+func (ps *parquetStream) write(samples []opSample, success bool) {
+	if ps.err != nil || len(samples) == 0 {
+		return
+	}
+	ps.rows = ps.rows[:0]
+	for _, sample := range samples {
+		ps.rows = append(ps.rows, parquetRow{
+			StartTime:  sample.startTime,
+			Op:         sample.opType,
+			DurationNs: int64(sample.duration),
+			Size:       sample.size,
+			WorkerID:   int32(sample.workerID),
+			Success:    success,
+		})
+	}
+	_, ps.err = ps.pw.Write(ps.rows)
+}
+
+// close writes the last row group and the footer of the file.
+func (ps *parquetStream) close() error {
+	err := ps.err
+	if err == nil {
+		err = ps.pw.Close()
+	}
+	if err == nil {
+		err = ps.bw.Flush()
+	}
+	if cerr := ps.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// forEachOperation calls fn with each operation, ordered by start
+// time, and whether it succeeded. Failed operations are those
+// tolerated by -max-consecutive-errors.
+func forEachOperation(tr *TestResult, fn func(sample opSample, success bool) error) error {
+	failed := append([]opSample(nil), tr.failed...)
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].startTime.Before(failed[j].startTime)
+	})
+	for _, i := range tr.sampleOrder() {
+		sample := tr.samples[i]
+		for len(failed) > 0 && failed[0].startTime.Before(sample.startTime) {
+			if err := fn(failed[0], false); err != nil {
+				return err
+			}
+			failed = failed[1:]
+		}
+		if err := fn(sample, true); err != nil {
+			return err
+		}
+	}
+	for _, sample := range failed {
+		if err := fn(sample, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schema of the tables of the SQLite database: the run ID, and a row
+// for each operation.
+const (
+	sqliteRunTable        = "CREATE TABLE run(id TEXT)"
+	sqliteOperationsTable = "CREATE TABLE operations(start_time INTEGER, op TEXT, duration_ns INTEGER, " +
+		"size INTEGER, worker_id INTEGER, success INTEGER)"
+)
+
+// writeSQLiteFile writes a SQLite database with a record of each
+// operation, ordered by start time, in the operations table: its
+// start time in Unix nanoseconds, type, duration in nanoseconds, size,
+// worker id, and whether it succeeded. The run table holds the run
+// ID. The database is built by SQLite in a temporary directory, as
+// the driver needs a file, and then copied to w.
+func writeSQLiteFile(w io.Writer, tr *TestResult) error {
+	dir, err := os.MkdirTemp("", "minio-perftest-sqlite-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "operations.db")
+	if err := buildSQLiteDatabase(fileName, tr); err != nil {
+		return err
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// buildSQLiteDatabase creates the database of writeSQLiteFile in the
+// given file, with all rows inserted in one transaction.
+func buildSQLiteDatabase(fileName string, tr *TestResult) (err error) {
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// a no-op once the transaction is committed.
+	defer tx.Rollback()
+	for _, stmt := range []string{sqliteRunTable, sqliteOperationsTable} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO run(id) VALUES (?)", runID); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare("INSERT INTO operations(start_time, op, duration_ns, size, worker_id, success) " +
+		"VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	err = forEachOperation(tr, func(sample opSample, success bool) error {
+		var ok int64
+		if success {
+			ok = 1
+		}
+		_, err := insert.Exec(sample.startTime.UnixNano(), sample.opType, int64(sample.duration),
+			sample.size, int64(sample.workerID), ok)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeWarpFile writes the operations in the tab separated format of
+// the benchmark data of MinIO's warp tool, ordered by start time, so
+// that it can be analyzed with "warp analyze". Only the fields that
+// are recorded are filled in: the object names, errors and times to
+// the first byte are left empty.
+func writeWarpFile(w io.Writer, tr *TestResult) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("idx\tthread\top\tclient_id\tn_objects\tbytes\tendpoint\tfile\terror\tstart\tfirst_byte\tend\tduration_ns\n"); err != nil {
+		return err
+	}
+	for idx, i := range tr.sampleOrder() {
+		sample := tr.samples[i]
+		end := sample.startTime.Add(sample.duration)
+		_, err := fmt.Fprintf(bw, "%d\t%d\t%s\t%s\t%d\t%d\t%s\t\t\t%s\t\t%s\t%d\n",
+			idx, sample.workerID, strings.ToUpper(sample.opType), runID, 1,
+			sample.size, endpoints[sample.endpoint].String(),
+			sample.startTime.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano),
+			int64(sample.duration))
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeCSVComment(bw, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// runConfig is the configuration of a run: the value of each flag,
+// and the arguments.
+type runConfig struct {
+	Flags map[string]string `json:"flags"`
+	Args  []string          `json:"args"`
+}
+
+// flags that are not part of a run's configuration.
+var nonConfigFlags = map[string]bool{"config": true, "dump-config": true}
+
+// writeConfig writes the effective value of every flag, and the
+// arguments, as JSON that can be read with -config.
+func writeConfig(w io.Writer, args []string) error {
+	cfg := runConfig{Flags: make(map[string]string), Args: args}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !nonConfigFlags[f.Name] {
+			cfg.Flags[f.Name] = f.Value.String()
+		}
+	})
+	if cfg.Args == nil {
+		cfg.Args = []string{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
+
+// loadConfig reads a configuration written by -dump-config and sets
+// each flag that was not given on the command line to its value.
+func loadConfig(fileName string) (cfg runConfig, err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+
+	onCommandLine := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		onCommandLine[f.Name] = true
+	})
+	for name, value := range cfg.Flags {
+		if nonConfigFlags[name] {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return cfg, fmt.Errorf("unknown flag %q", name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		if err = flag.Set(name, value); err != nil {
+			return cfg, fmt.Errorf("invalid value %q for flag %q - %w", value, name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// workerOutput is a worker's own CSV file of its operations, with
+// the same columns as the CSV output file.
+type workerOutput struct {
+	f  *os.File
+	bw *bufio.Writer
+	cw *csv.Writer
+}
+
+// newWorkerOutput creates the CSV file of the worker in perWorkerDir.
+func newWorkerOutput(workerID int) (*workerOutput, error) {
+	f, err := os.Create(filepath.Join(perWorkerDir, fmt.Sprintf("worker-%03d.csv", workerID)))
+	if err != nil {
+		return nil, err
+	}
+	out := &workerOutput{f: f, bw: bufio.NewWriter(f)}
+	out.cw = csv.NewWriter(out.bw)
+	if err = writeCSVComment(out.bw, "minio-perftest run %v worker %v", runID, workerID); err == nil {
+		err = out.cw.Write(csvColumns())
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// write records a successful operation.
+func (out *workerOutput) write(msg workerMsg) error {
+	if msg.abandoned || msg.skipped || msg.conflictCode != "" {
+		return nil
+	}
+	record := []string{
+		formatCSVTime(msg.putStartTime),
+		msg.opType,
+		strconv.FormatInt(int64(msg.putDuration), 10),
+		strconv.FormatInt(msg.objectSize, 10),
+	}
+	if measureGeneration {
+		record = append(record, strconv.FormatInt(int64(msg.genDuration), 10))
+	}
+	return out.cw.Write(record)
+}
+
+func (out *workerOutput) close() error {
+	out.cw.Flush()
+	err := out.cw.Error()
+	if err == nil {
+		err = out.bw.Flush()
+	}
+	if cerr := out.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// plot formats
+const (
+	// gnuplot script that plots the CSV file
+	plotGnuplot = "gnuplot"
+
+	// Vega-Lite chart with the samples inlined
+	plotVegaLite = "vega-lite"
+)
+
+// writeGnuplotScript writes a gnuplot script that plots the
+// throughput over time and the latency CDF from the CSV file at
+// csvPath, to a PNG image next to the plot file.
+func writeGnuplotScript(w io.Writer, tr *TestResult, csvPath string) error {
+	// seconds since the start of the test, from the time column.
+	var timeExpr string
+	switch timeFormat {
+	case timeFormatUnix:
+		timeExpr = "($1 - t0)"
+	case timeFormatRFC3339:
+		timeExpr = `(timecolumn(1, "%Y-%m-%dT%H:%M:%SZ") - t0)`
+	default:
+		timeExpr = "($1 / 1e9 - t0)"
+	}
+	image := strings.TrimSuffix(plotFile, filepath.Ext(plotFile)) + ".png"
+	// with -record-concurrency, the active workers are plotted from
+	// a data block below the other charts.
+	rows, height, activeData, activePlot := 2, 900, "", ""
+	if recordConcurrency {
+		rows, height = 3, 1350
+		var b strings.Builder
+		// the first line is the column header, like in the
+		// CSV file.
+		b.WriteString("$active << EOD\nsecond,active_workers\n")
+		for sec, active := range tr.secondConcurrency() {
+			fmt.Fprintf(&b, "%v,%.2f\n", sec, active)
+		}
+		activeData = b.String() + "EOD\n"
+		activePlot = `
+set title "Active workers over time"
+set xlabel "Time since start (s)"
+set ylabel "Workers"
+plot $active using 1:2 with steps notitle
+`
+	}
+	_, err := fmt.Fprintf(w, `# minio-perftest run %[1]v
+# Plots the results in %[2]v to %[3]v.
+%[10]vset datafile separator ","
+set key autotitle columnhead
+set terminal pngcairo size 1200,%[9]d
+set output %[3]q
+set multiplot layout %[8]d,1
+t0 = %[4]d.%09[5]d
+
+set title "Throughput over time"
+set xlabel "Time since start (s)"
+set ylabel "MiB/s"
+plot %[2]q using (floor(%[6]v)):($4 / 1048576.0 / %[7]v) smooth frequency with steps title "MiB/s"
+
+set title "Latency CDF"
+set xlabel "Latency (ms)"
+set ylabel "Fraction of operations"
+plot %[2]q using ($3 / 1e6):(1.0) smooth cnormal with lines title "latency"
+%[11]v
+unset multiplot
+`, runID, csvPath, image, tr.startTime.Unix(), tr.startTime.Nanosecond(), timeExpr, csvSampleRate,
+		rows, height, activeData, activePlot)
+	return err
+}
+
+// writeVegaLiteSpec writes a Vega-Lite chart of the throughput over
+// time and the latency CDF. The CSV file starts with a comment line,
+// which Vega-Lite cannot parse, so the samples are inlined.
+func writeVegaLiteSpec(w io.Writer, tr *TestResult) error {
+	values := make([]map[string]interface{}, 0, len(tr.samples))
+	for _, i := range tr.sampleOrder() {
+		sample := tr.samples[i]
+		values = append(values, map[string]interface{}{
+			"t":         sample.startTime.Sub(tr.startTime).Seconds(),
+			"op":        sample.opType,
+			"latencyMs": float64(sample.duration) / float64(time.Millisecond),
+			"mib":       float64(sample.size) / (1024 * 1024),
+		})
+	}
+	spec := map[string]interface{}{
+		"$schema":     "https://vega.github.io/schema/vega-lite/v5.json",
+		"description": "minio-perftest run " + runID,
+		"data":        map[string]interface{}{"values": values},
+		"vconcat": []interface{}{
+			map[string]interface{}{
+				"title": "Throughput over time",
+				"mark":  "line",
+				"transform": []interface{}{
+					map[string]interface{}{"calculate": "floor(datum.t)", "as": "second"},
+					map[string]interface{}{
+						"aggregate": []interface{}{
+							map[string]interface{}{"op": "sum", "field": "mib", "as": "mibps"},
+						},
+						"groupby": []string{"second"},
+					},
+				},
+				"encoding": map[string]interface{}{
+					"x": map[string]interface{}{"field": "second", "type": "quantitative", "title": "Time since start (s)"},
+					"y": map[string]interface{}{"field": "mibps", "type": "quantitative", "title": "MiB/s"},
+				},
+			},
+			map[string]interface{}{
+				"title": "Latency CDF",
+				"mark":  "line",
+				"transform": []interface{}{
+					map[string]interface{}{
+						"window": []interface{}{
+							map[string]interface{}{"op": "cume_dist", "as": "fraction"},
+						},
+						"sort": []interface{}{
+							map[string]interface{}{"field": "latencyMs"},
+						},
+					},
+				},
+				"encoding": map[string]interface{}{
+					"x": map[string]interface{}{"field": "latencyMs", "type": "quantitative", "title": "Latency (ms)"},
+					"y": map[string]interface{}{"field": "fraction", "type": "quantitative", "title": "Fraction of operations"},
+				},
+			},
+		},
+	}
+	if recordConcurrency {
+		var active []map[string]interface{}
+		for sec, workers := range tr.secondConcurrency() {
+			active = append(active, map[string]interface{}{"second": sec, "workers": workers})
+		}
+		spec["vconcat"] = append(spec["vconcat"].([]interface{}), map[string]interface{}{
+			"title": "Active workers over time",
+			"data":  map[string]interface{}{"values": active},
+			"mark":  map[string]interface{}{"type": "line", "interpolate": "step-after"},
+			"encoding": map[string]interface{}{
+				"x": map[string]interface{}{"field": "second", "type": "quantitative", "title": "Time since start (s)"},
+				"y": map[string]interface{}{"field": "workers", "type": "quantitative", "title": "Workers"},
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
+
+// writeRateFile writes the number of operations completed in each
+// second of the test, and their mean, maximum and 99th percentile
+// latency, as CSV, preceded by a comment line with the run ID.
+func writeRateFile(w io.Writer, tr *TestResult) error {
+	header := "second,ops,mean_latency_ns,max_latency_ns,p99_latency_ns"
+	if conns != nil {
+		header += ",new_conns"
+	}
+	if limiter != nil {
+		header += ",window"
+	}
+	var active []float64
+	if recordConcurrency {
+		header += ",active_workers"
+		active = tr.secondConcurrency()
+	}
+	if healthcheck {
+		header += ",healthcheck_latency_ns"
+	}
+	if err := writeCSVComment(w, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, header); err != nil {
+		return err
+	}
+	p99s := tr.secondPercentiles(99)
+	first, end := tr.reportedSeconds()
+	health := tr.secondHealthcheck(end)
+	for sec := first; sec < end; sec++ {
+		var mean time.Duration
+		if count := tr.secondCount[sec]; count > 0 {
+			mean = tr.secondLatency[sec].total / time.Duration(count)
+		}
+		row := fmt.Sprintf("%v,%v,%v,%v,%v", sec, tr.secondCount[sec],
+			int64(mean), int64(tr.secondLatency[sec].max), int64(p99s[sec]))
+		if conns != nil {
+			var newConns int64
+			if sec < len(tr.secondNewConns) {
+				newConns = tr.secondNewConns[sec]
+			}
+			row += fmt.Sprintf(",%v", newConns)
+		}
+		if limiter != nil {
+			// the window during the second, which was set at
+			// its start.
+			window := concurrency
+			if sec > 0 && sec <= len(tr.adaptive.SecondWindow) {
+				window = tr.adaptive.SecondWindow[sec-1]
+			}
+			row += fmt.Sprintf(",%v", window)
+		}
+		if active != nil {
+			row += fmt.Sprintf(",%.2f", active[sec])
+		}
+		if healthcheck {
+			// empty if no health-check upload succeeded in
+			// the second.
+			row += ","
+			if health[sec] > 0 {
+				row += strconv.FormatInt(int64(health[sec]), 10)
+			}
+		}
+		if _, err := fmt.Fprintln(w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCDFFile writes the cumulative distribution of the latencies
+// as CSV, preceded with -csv-comments by a comment line with the run
+// ID: each row is a latency and the fraction of operations that took
+// at most that long. With more than cdfPoints samples, only
+// cdfPoints evenly spaced ranks are written, always including the
+// maximum.
+func writeCDFFile(w io.Writer, tr *TestResult) error {
+	if err := writeCSVComment(w, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "latency_ns,probability"); err != nil {
+		return err
+	}
+	sorted := tr.sortedDurations("")
+	n := len(sorted)
+	points := n
+	if cdfPoints > 0 && cdfPoints < n {
+		points = cdfPoints
+	}
+	for k := 1; k <= points; k++ {
+		// rank of the k-th point, rounded up so that the last
+		// point is the maximum.
+		rank := (k*n + points - 1) / points
+		_, err := fmt.Fprintf(w, "%v,%v\n", int64(sorted[rank-1]),
+			strconv.FormatFloat(float64(rank)/float64(n), 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQueueingFile writes a CSV row for each operation, ordered by
+// start time, for queueing analysis: its start time, worker and type,
+// the time since the previous operation of the same worker started
+// and since the previous operation of any worker started (empty for
+// the first one), and its service time, the duration of the
+// operation.
+func writeQueueingFile(w io.Writer, tr *TestResult) error {
+	if err := writeCSVComment(w, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{csvTimeColumn(), "worker", "op", "worker_interarrival_ns", "interarrival_ns", "service_ns"})
+	if err != nil {
+		return err
+	}
+	workerLast := make(map[int]time.Time)
+	var last time.Time
+	gap := func(start, prev time.Time) string {
+		if prev.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(int64(start.Sub(prev)), 10)
+	}
+	for _, i := range tr.sampleOrder() {
+		sample := tr.samples[i]
+		err := cw.Write([]string{
+			formatCSVTime(sample.startTime),
+			strconv.Itoa(sample.workerID),
+			sample.opType,
+			gap(sample.startTime, workerLast[sample.workerID]),
+			gap(sample.startTime, last),
+			strconv.FormatInt(int64(sample.duration), 10),
+		})
+		if err != nil {
+			return err
+		}
+		workerLast[sample.workerID] = sample.startTime
+		last = sample.startTime
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// outputFile is an output written to a file after the test.
+type outputFile struct {
+	fileName string
+	write    func(io.Writer) error
+}
+
+// manifestEntry records an uploaded object.
+type manifestEntry struct {
+	Key       string `json:"key"`
+	VersionID string `json:"versionId,omitempty"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+
+	// seed bytes the object content was generated from, and the
+	// time the upload completed.
+	seedBytes []byte
+	endTime   time.Time
+}
+
+// manifest lists the objects uploaded in a run.
+type manifest struct {
+	RunID   string          `json:"runId"`
+	Bucket  string          `json:"bucket"`
+	Objects []manifestEntry `json:"objects"`
+}
+
+// recordManifest returns whether uploaded objects need to be
+// recorded.
+func recordManifest() bool {
+	return manifestFile != "" || audit || checkSize
+}
+
+// contentSHA256 returns the hex encoded SHA256 of the object's
+// content, which is generated again from its seed bytes.
+func (e *manifestEntry) contentSHA256() string {
+	object := newObjGen(e.Key, e.Size, e.seedBytes)
+	hasher := sha256.New()
+	// reading generated content does not fail.
+	_, _ = io.Copy(hasher, &object)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// getManifest returns the manifest of the test's uploads, sorted by
+// key, with the content hashes computed.
+func (tr *TestResult) getManifest() manifest {
+	m := manifest{RunID: runID, Bucket: bucket}
+	for _, entry := range tr.manifest {
+		if mode == modeMixed && !liveKeys.contains(entry.Key) {
+			// deleted during the test.
+			continue
+		}
+		if manifestFile != "" || audit {
+			// the size check does not need the hashes.
+			entry.SHA256 = entry.contentSHA256()
+		}
+		m.Objects = append(m.Objects, entry)
+	}
+	sort.Slice(m.Objects, func(i, j int) bool {
+		return m.Objects[i].Key < m.Objects[j].Key
+	})
+	return m
+}
+
+func writeManifest(w io.Writer, m manifest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// writeFile creates fileName and writes its content with write.
+func writeFile(fileName string, write func(io.Writer) error) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err = write(bw); err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeOutputFile writes an output file with write, retrying with
+// backoff on failure, so that a transient error does not lose the
+// results of a long run. If all attempts fail, the output is written
+// to a file in the temporary directory instead. Returns the name of
+// the file written.
+func writeOutputFile(fileName string, write func(io.Writer) error) (string, error) {
+	delay := outputRetryDelay
+	var err error
+	for attempt := 1; attempt <= outputWriteAttempts; attempt++ {
+		if err = writeFile(fileName, write); err == nil {
+			return fileName, nil
+		}
+		fmt.Printf("Error writing %v (attempt %v of %v): %v\n",
+			fileName, attempt, outputWriteAttempts, err)
+		if attempt < outputWriteAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	fallback := filepath.Join(os.TempDir(),
+		fmt.Sprintf("minio-perftest-%v-%v", runID, filepath.Base(fileName)))
+	if ferr := writeFile(fallback, write); ferr != nil {
+		return "", fmt.Errorf("%v (writing fallback %v: %v)", err, fallback, ferr)
+	}
+	fmt.Printf("Could not write %v - wrote %v instead.\n", fileName, fallback)
+	return fallback, nil
+}
+
+// auditResult summarizes the checks of uploaded objects against the
+// manifest.
+type auditResult struct {
+	checked int
+	missing int
+	corrupt int
+	failed  int
+
+	// result of each object's check.
+	objects []verifyResult
+}
+
+// object verification statuses.
+const (
+	verifyOK      = "ok"
+	verifyMissing = "missing"
+	verifyCorrupt = "corrupt"
+	verifyFailed  = "failed"
+)
+
+// verifyResult is the result of checking a downloaded object against
+// its manifest entry.
+type verifyResult struct {
+	entry  manifestEntry
+	status string
+
+	// size and hash of the downloaded content.
+	size   int64
+	sha256 string
+
+	// description of the problem found, if any.
+	detail string
+}
+
+// verifyStream reads object content from r through a SHA256 hasher,
+// without buffering the content, and checks its size and hash
+// against the manifest entry. This keeps memory use constant for any
+// object size.
+func verifyStream(r io.Reader, entry manifestEntry) verifyResult {
+	res := verifyResult{entry: entry}
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, r)
+	res.size = n
+	if err != nil {
+		res.status = verifyFailed
+		res.detail = err.Error()
+		return res
+	}
+	res.sha256 = hex.EncodeToString(hasher.Sum(nil))
+	switch {
+	case n != entry.Size:
+		res.status = verifyCorrupt
+		res.detail = fmt.Sprintf("size is %v, expected %v", n, entry.Size)
+	case res.sha256 != entry.SHA256:
+		res.status = verifyCorrupt
+		res.detail = fmt.Sprintf("sha256 is %v, expected %v", res.sha256, entry.SHA256)
+	default:
+		res.status = verifyOK
+	}
+	return res
+}
+
+// auditObject downloads an object and checks it against its
+// manifest entry.
+func auditObject(s3Client *s3.S3, entry manifestEntry) verifyResult {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(entry.Key),
+	}
+	if entry.VersionID != "" {
+		input.VersionId = aws.String(entry.VersionID)
+	}
+	out, err := s3Client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return verifyResult{entry: entry, status: verifyMissing}
+		}
+		return verifyResult{entry: entry, status: verifyFailed, detail: err.Error()}
+	}
+	defer out.Body.Close()
+	return verifyStream(out.Body, entry)
+}
+
+// checkObjectSize checks the size of an object against its manifest
+// entry, without downloading it.
+func checkObjectSize(s3Client *s3.S3, entry manifestEntry) verifyResult {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(entry.Key),
+	}
+	if entry.VersionID != "" {
+		input.VersionId = aws.String(entry.VersionID)
+	}
+	out, err := s3Client.HeadObject(input)
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+			return verifyResult{entry: entry, status: verifyMissing}
+		}
+		return verifyResult{entry: entry, status: verifyFailed, detail: err.Error()}
+	}
+	res := verifyResult{entry: entry, status: verifyOK, size: aws.Int64Value(out.ContentLength)}
+	if res.size != entry.Size {
+		res.status = verifyCorrupt
+		res.detail = fmt.Sprintf("size is %v, expected %v", res.size, entry.Size)
+	}
+	return res
+}
+
+// writeAuditReport writes the result of each object's check as CSV.
+func writeAuditReport(w io.Writer, res auditResult) error {
+	if err := writeCSVComment(w, "minio-perftest run %v", runID); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"key", "status", "size", "sha256",
+		"expected_size", "expected_sha256", "detail"})
+	if err != nil {
+		return err
+	}
+	for _, obj := range res.objects {
+		err = cw.Write([]string{
+			obj.entry.Key, obj.status,
+			strconv.FormatInt(obj.size, 10), obj.sha256,
+			strconv.FormatInt(obj.entry.Size, 10), obj.entry.SHA256,
+			obj.detail,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// checkObjects checks all objects in the manifest with check, using
+// concurrency parallel workers. Problems found are printed, prefixed
+// with the name of the check.
+func checkObjects(m manifest, name string, check func(*s3.S3, manifestEntry) verifyResult) (res auditResult, err error) {
+	session, err := getAWSSession()
+	if err != nil {
+		return res, err
+	}
+
+	entryCh := make(chan manifestEntry)
+	msgCh := make(chan verifyResult)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s3Client := s3.New(session)
+			for entry := range entryCh {
+				msgCh <- check(s3Client, entry)
+			}
+		}()
+	}
+	go func() {
+		for _, entry := range m.Objects {
+			entryCh <- entry
+		}
+		close(entryCh)
+		wg.Wait()
+		close(msgCh)
+	}()
+
+	prog := startProgress(name, int64(len(m.Objects)))
+	for msg := range msgCh {
+		res.checked++
+		res.objects = append(res.objects, msg)
+		prog.add(1)
+		switch msg.status {
+		case verifyFailed:
+			res.failed++
+			prog.printf("%v of %v failed: %v\n", name, msg.entry.Key, msg.detail)
+		case verifyMissing:
+			res.missing++
+			prog.printf("%v: %v is missing.\n", name, msg.entry.Key)
+		case verifyCorrupt:
+			res.corrupt++
+			prog.printf("%v: %v is corrupt - %v.\n", name, msg.entry.Key, msg.detail)
+		}
+	}
+	prog.finish()
+	return res, nil
+}
+
+/*
+
+Worker Algo:
+
+1. Generate objects of specified size, and upload sequentially to
+service.
+
+2. Report each success via a channel
+
+3. Terminate on:
+   a. Error, or
+   b. the test duration (15 minutes by default) passes and at least
+      10 objects are uploaded.
+   c. Receiving signal to quit.
+
+In the main thread, setup required number of worker threads, and:
+
+1. Record each success and calculate objects/second metric.
+
+2. On error, signal all workers to quit.
+
+3. Wait for threads to quit, and report metrics.
+
+*/
+
+func init() {
+	flag.StringVar(&configFile, "config", "", "Read flag values and arguments from a configuration written by -dump-config; flags on the command line take precedence")
+	flag.BoolVar(&dumpConfig, "dump-config", false, "Print the effective configuration as JSON and exit")
+	flag.StringVar(&mode, "mode", modePut, "benchmark mode - one of put, list-incomplete, probe, mixed, attributes, versions, presigned-get, delete-markers, restore, read-after-write, select, tiny, get, delete, stat")
+	flag.DurationVar(&workerDuration, "duration", defaultWorkerDuration, "Minimum duration of the test")
+	flag.DurationVar(&delayStart, "delay-start", 0, "Wait this long before starting the workers, printing a countdown")
+	flag.DurationVar(&startJitter, "start-jitter", 0, "Make each worker wait a random time up to this long before its first operation, to spread out connection establishment")
+	flag.DurationVar(&hangDumpAfter, "hang-dump-after", 0, "Dump the stacks of all goroutines to a file when no operation completed for this long (0 to disable)")
+	flag.DurationVar(&maxRuntime, "max-runtime", 0, "Stop the test after this wall-clock time, even if the workers are not done (0 for no limit)")
+	flag.DurationVar(&probeInterval, "probe-interval", time.Second, "Pause between requests in probe mode")
+	flag.StringVar(&percentilesSpec, "percentiles", "50,90,99,99.9,99.99", "Latency percentiles to report")
+	flag.StringVar(&workloadSpec, "workload", "get:80,put:15,delete:5", "Weighted operation mix of the mixed mode - operations are put, get, delete, stat")
+	flag.IntVar(&versionKeyCount, "version-keys", 10, "Number of keys to write versions of in versions mode")
+	flag.IntVar(&versionCount, "versions", 100, "Number of versions to write of each key in versions mode")
+	flag.StringVar(&restorePrefix, "restore-prefix", "", "In restore mode, restore the objects in a cold tier under this prefix")
+	flag.Int64Var(&restoreDays, "restore-days", 1, "In restore mode, the number of days to restore objects for")
+	flag.DurationVar(&restorePoll, "restore-poll", time.Second, "In restore mode, the interval at which to check whether a restore completed")
+	flag.DurationVar(&restoreTimeout, "restore-timeout", time.Hour, "In restore mode, the maximum time to wait for a restore to complete")
+	flag.StringVar(&selectFormat, "select-format", selectCSV, "In select mode, the format of the prepopulated objects - one of csv, json (JSON lines)")
+	flag.StringVar(&selectQuery, "select-query", "SELECT s.id, s.name FROM S3Object s WHERE CAST(s.value AS INT) < 10", "In select mode, the SQL expression to query the objects with; the records have the fields id, name and value (0 to 999)")
+	flag.DurationVar(&visibilityPoll, "visibility-poll", 0, "In read-after-write mode, the interval between reads of an uploaded object until it is visible (0 reads in a tight loop)")
+	flag.DurationVar(&visibilityTimeout, "visibility-timeout", 30*time.Second, "In read-after-write mode, the maximum time to wait for an uploaded object to be visible")
+	flag.BoolVar(&deleteVersions, "delete-versions", false, "In delete-markers mode, also permanently delete the uploaded versions and the delete markers")
+	flag.IntVar(&prepopulateCount, "prepopulate", 0, "Upload this many objects before the test")
+	flag.StringVar(&splitSpec, "split", "", "Percentages of the workers using each endpoint given to -h (e.g. 50/50) - by default, workers are spread evenly")
+	flag.StringVar(&endpoint, "h", "localhost:9000", "service endpoint host, or a comma separated list of endpoints with an optional scheme (e.g. https://a:9000,http://b:9000)")
+	flag.BoolVar(&secure, "s", false, "Set if endpoints without a scheme require https")
+	flag.StringVar(&bucket, "bucket", "bucket", "Bucket to use for uploads test")
+	flag.StringVar(&bucketsSpec, "buckets", "", "Comma-separated buckets to spread the workers and the -prepopulate objects over, instead of -bucket")
+	flag.IntVar(&concurrency, "c", 1, "concurrency - number of parallel uploads")
+	flag.Int64Var(&randomSeed, "seed", defaultRandomSeed, "random seed")
+	flag.IntVar(&maxDiskUsageGB, "m", 80, "Maximum amount of disk usage in GBs")
+	flag.IntVar(&keyCardinality, "key-cardinality", 0, "Name objects from exactly this many distinct keys, generated before the test, instead of a number depending on -m")
+	flag.StringVar(&partSizeStr, "part-size", "", "Upload objects with multipart uploads using the given part size (e.g. 5MiB)")
+	flag.Float64Var(&abortRate, "abort-rate", 0, "Fraction (0 to 1) of multipart uploads to leave incomplete")
+	flag.Float64Var(&overwriteRatio, "overwrite-ratio", 0, "Fraction (0 to 1) of uploads that overwrite an existing object instead of creating a new one")
+	flag.StringVar(&checksumAlgorithm, "checksum", "", "Send a checksum of the content with each upload - one of crc32c, sha256, crc64nvme")
+	flag.BoolVar(&manualMultipart, "manual-multipart", false, "Upload objects with multipart uploads and report the latencies of the create, part upload and complete requests separately")
+	flag.BoolVar(&emptyBucket, "empty-bucket", false, "Remove all objects in the bucket before the test (asks for confirmation unless -force is given)")
+	flag.BoolVar(&force, "force", false, "Do not ask for confirmation of destructive actions")
+	flag.BoolVar(&cleanupIncomplete, "cleanup-incomplete", false, "Remove incomplete multipart uploads in the bucket after the test")
+	flag.BoolVar(&sizesFromStdin, "sizes-from-stdin", false, "Read object sizes from stdin, one per line, and upload one object per size")
+	flag.IntVar(&batchSize, "batch-size", 100, "Maximum number of operation results a worker sends to the collector at once")
+	flag.IntVar(&collectors, "collectors", 1, "Number of goroutines collecting the results of the workers")
+	flag.IntVar(&maxSamples, "max-samples", 0, "Maximum number of operation latency samples to keep (0 for no limit)")
+	flag.StringVar(&csvFile, "csv", "", "Write the start time, type, duration and size of each operation to the given CSV file")
+	flag.StringVar(&queueingFile, "queueing-file", "", "Write the inter-arrival and service time of each operation to the given CSV file, for queueing analysis")
+	flag.StringVar(&parquetFile, "parquet", "", "Write the start time, type, duration, size, worker id and success of each operation to the given Parquet file")
+	flag.StringVar(&sqliteFile, "sqlite", "", "Write the start time, type, duration, size, worker id and success of each operation to a table of the given SQLite database")
+	flag.StringVar(&perWorkerDir, "per-worker-output", "", "Write a CSV file of each worker's operations to the given directory")
+	flag.Float64Var(&csvSampleRate, "sample-rate", 1, "Fraction (0 to 1) of the operations to write to the CSV file, picked at random")
+	flag.BoolVar(&csvComments, "csv-comments", false, "Start the CSV files with comment lines (starting with #) with the run ID and the sample rate")
+	flag.StringVar(&timeFormat, "time-format", timeFormatNano, "Format of the start times in the CSV file - one of nano, unix, rfc3339")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve a Prometheus histogram of the operation latency at /metrics on this address (e.g. :9100)")
+	flag.StringVar(&metricLabelsSpec, "metric-labels", "", "Static labels to add to all metrics served by -metrics-addr, e.g. cluster=staging,run=nightly")
+	flag.BoolVar(&exemplars, "exemplars", false, "Send a trace id with each operation and serve the histogram in the OpenMetrics format, with exemplars linking latencies to trace ids")
+	flag.StringVar(&wsAddr, "ws-addr", "", "Stream the result of each operation as JSON to WebSocket clients connecting to this address (e.g. :8080)")
+	flag.StringVar(&kafkaBrokersStr, "kafka-brokers", "", "Comma-separated host:port addresses of Kafka brokers to publish the result of each operation to, with -kafka-topic")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "", "Kafka topic to publish the result of each operation to as JSON")
+	flag.StringVar(&plotFile, "plot", "", "Write a plot of the throughput over time and the latency CDF to the given file")
+	flag.StringVar(&plotFormat, "plot-format", plotGnuplot, "Format of the plot - one of gnuplot (a script plotting the -csv file), vega-lite")
+	flag.StringVar(&summaryFormat, "summary-format", summaryText, "Format of the summary printed at the end of the test - one of text, markdown (GitHub-flavored tables, for pasting into issues)")
+	flag.StringVar(&jsonSummaryFile, "json-summary", "", "Write a summary of the test to the given JSON file")
+	flag.StringVar(&webhookURL, "webhook-url", "", "POST the JSON summary of the test to the given URL when it ends")
+	flag.BoolVar(&completeSeconds, "complete-seconds", false, "Leave the partial first and last seconds of the test out of the per-second operation counts")
+	flag.StringVar(&warpFile, "warp-output", "", "Write the operations to the given file in the benchmark data format of warp, for \"warp analyze\"")
+	flag.StringVar(&rateFile, "rate-file", "", "Write the number of operations completed in each second to the given CSV file")
+	flag.BoolVar(&recordConcurrency, "record-concurrency", false, "Record the number of active workers in each second, in the -rate-file and the -plot")
+	flag.BoolVar(&healthcheck, "healthcheck", false, "Upload a small object each second apart from the workers and report its latency, also in the -rate-file")
+	flag.StringVar(&cdfFile, "cdf-file", "", "Write the cumulative distribution of the latencies to the given CSV file")
+	flag.IntVar(&cdfPoints, "cdf-points", 1000, "Maximum number of points in the -cdf-file (0 for one per operation)")
+	flag.StringVar(&manifestFile, "manifest", "", "Write the list of uploaded objects with their sizes and hashes to the given file")
+	flag.BoolVar(&audit, "audit", false, "Download all uploaded objects after the test and check them against the manifest")
+	flag.BoolVar(&checkSize, "check-size", false, "Check the size of all uploaded objects after the test, without downloading them")
+	flag.StringVar(&faultInjectSpec, "fault-inject", "", "For testing this program: inject faults into requests, e.g. \"error=0.01,delay=0.05,delay-time=500ms\"")
+	flag.StringVar(&auditReportFile, "audit-report", "", "Write the audit result of each object to the given CSV file")
+	flag.BoolVar(&syncStop, "sync-stop", true, "Stop all workers together when the test duration has passed")
+	flag.IntVar(&iterationsPerWorker, "iterations-per-worker", 0, "Stop each worker after this many successful operations, instead of after the test duration")
+	flag.DurationVar(&staggerWarn, "stagger-warn", 10*time.Second, "Warn if workers finish over a longer span than this")
+	flag.BoolVar(&excludeRampdown, "exclude-rampdown", false, "Exclude operations started after the first worker finished from latency statistics")
+	flag.StringVar(&traceFile, "trace", "", "Write a Go execution trace of the test to the given file")
+	flag.StringVar(&thinkTimeSpec, "think-time", "0s", "Time a worker waits after each operation before starting the next - a duration, or a range such as 100ms-500ms to pick from at random")
+	flag.StringVar(&sizePrefixSpec, "size-prefix", "", "Upload objects of each size class under a key prefix, e.g. \"small=hot/,large=cold/\"")
+	flag.StringVar(&sizeThresholdStr, "size-threshold", "1MiB", "Size from which objects are in the large class of -size-prefix")
+	flag.StringVar(&targetKey, "target-key", "", "Read only this existing key - in probe mode, download it instead of uploading, to monitor its latency")
+	flag.IntVar(&pregenNameCount, "pregenerate-names", 0, "Generate the names of this many objects before the test, and end the test once each is uploaded")
+	flag.StringVar(&keyHashPrefix, "hash-prefix", "", "Pick random object names whose hex encoded hash starts with this prefix, to concentrate the load on one shard")
+	flag.StringVar(&keyHashAlgorithm, "hash-algorithm", keyHashMD5, "Hash of the object names for -hash-prefix - one of md5, sha256, crc32")
+	flag.IntVar(&maxKeyLength, "max-key-length", 0, "Truncate generated object names to at most this many bytes (0 for no limit; S3 allows 1024)")
+	flag.IntVar(&keyHashAttempts, "hash-attempts", 1000000, "Maximum number of names tried for each name with -hash-prefix")
+	flag.Int64Var(&keyHashBudget, "hash-budget", 10000000, "Maximum number of names tried for all names with -hash-prefix - once used up, names are not matched to the prefix")
+	flag.StringVar(&parentDirsFile, "parent-dirs-file", "", "Read the parent dirs of random object names from the given file, one per line, instead of using the built-in ones")
+	flag.StringVar(&keyTemplateSpec, "key-template", "", "Name uploaded objects from this template instead of randomly, e.g. \"{date}/{worker}/{seq}-{rand}\" - placeholders are date, worker, seq and rand")
+	flag.StringVar(&hotspotKey, "hotspot-key", "", "Upload all objects to this key, to stress concurrent writes of one object")
+	flag.Float64Var(&compressibility, "compressibility", 0, "Fraction (0 to 1) of each object's content that is compressible, with the rest random - e.g. 0.5 for about 2:1 compressible content")
+	flag.StringVar(&payloadFile, "payload-file", "", "Read the content of uploaded objects from slices of the given file, mapped into memory, instead of generating it")
+	flag.BoolVar(&measureGeneration, "measure-generation", false, "Measure the time spent generating the content of each upload, and report its share of the upload latency")
+	flag.StringVar(&contentPattern, "content-pattern", patternRepeating, "Content of the objects - one of repeating, random, zeros, ones, sequential")
+	flag.BoolVar(&uniqueContent, "unique-content", false, "Generate content that is unique throughout each object and across objects, to defeat deduplication")
+	flag.Int64Var(&sizeReps, "size-reps", 0, "Set the object size to this many repetitions of the 36 byte content seed, instead of the size argument")
+	flag.BoolVar(&pauseSignal, "pause-signal", false, "Toggle pausing of the load on receiving SIGUSR1")
+	flag.DurationVar(&dialTimeout, "dial-timeout", 5*time.Second, "Timeout of establishing a connection to an endpoint")
+	flag.DurationVar(&opTimeout, "op-timeout", 0, "Timeout of each operation, including its retries (0 for no timeout)")
+	flag.DurationVar(&dnsRetryTimeout, "dns-retry-timeout", 0, "Keep retrying requests that fail to resolve the endpoint for up to this long, beyond the SDK retries (0 to only use the SDK retries)")
+	flag.IntVar(&maxConsecutiveErrors, "max-consecutive-errors", 1, "Abort the test once this many operations in a row have failed")
+	flag.BoolVar(&recordErrorLatency, "record-error-latency", false, "Record the time until each failed operation tolerated by -max-consecutive-errors failed, and report it separately")
+	flag.DurationVar(&retryBase, "retry-base", 0, "Delay before the first retry of a request, doubled for each further retry (0 for the SDK default)")
+	flag.DurationVar(&retryMax, "retry-max", 0, "Maximum delay before a retry of a request (0 for the SDK default)")
+	flag.BoolVar(&retryJitter, "retry-jitter", true, "Randomize the delays before retries")
+	flag.IntVar(&sdkRetries, "sdk-retries", aws.UseServiceDefaultRetries, "Maximum number of retries of a failed request by the SDK (-1 for the SDK default)")
+	flag.Uint64Var(&maxOpenFiles, "max-open-files", 0, "Number of open files the test needs - the open file limit is raised to it if lower (default estimated from -c)")
+	flag.BoolVar(&adaptive, "adaptive", false, "Adapt the number of operations in flight to the rate of throttling (503 and 429) responses of the server")
+	flag.BoolVar(&autoConcurrency, "autoconcurrency", false, "Pick the concurrency with short calibration runs at doubling concurrency levels up to -c, before the test")
+	flag.DurationVar(&autoConcurrencyStep, "autoconcurrency-step", 10*time.Second, "Duration of each calibration run of -autoconcurrency")
+	flag.Float64Var(&autoConcurrencyGain, "autoconcurrency-gain", 0.1, "Fraction by which doubling the concurrency must raise the ops/s for -autoconcurrency to pick the higher level")
+	flag.Float64Var(&adaptiveThreshold, "adaptive-threshold", 0.05, "Fraction of throttling responses per second above which -adaptive reduces the operations in flight")
+	flag.Float64Var(&opRate, "rate", 0, "Maximum number of operations per second of all workers together (0 for no limit)")
+	flag.StringVar(&rateOpsSpec, "rate-ops", "", "Comma separated operation types of the mixed mode to which -rate applies, e.g. put (default all)")
+	flag.BoolVar(&connStats, "conn-stats", false, "Count the new and reused connections of the requests, and report the rate of new connections")
+	flag.StringVar(&bufferSizeStr, "buffer-size", "", "Size of the network read and write buffers (e.g. 64KiB)")
+	flag.BoolVar(&tcpNoDelay, "tcp-nodelay", true, "Disable Nagle's algorithm on the connections (set -tcp-nodelay=false to enable it)")
+}
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			fmt.Println("Invalid -config given:", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			args = cfg.Args
+		}
+	}
+	if dumpConfig {
+		if err := writeConfig(os.Stdout, args); err != nil {
+			fmt.Println("Error writing the configuration:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var size int64
+	var err error
+	switch mode {
+	case modePut, modeProbe, modeMixed, modeAttributes, modeVersions, modePresignedGet, modeDeleteMarkers,
+		modeReadAfterWrite, modeSelect, modeGet, modeDelete, modeStat:
+		if targetKey != "" && (mode == modeProbe || mode == modeAttributes || mode == modePresignedGet || mode == modeGet ||
+			mode == modeStat) &&
+			len(args) == 0 {
+			// only the target key is read.
+			break
+		}
+		if mode == modeGet && prepopulateCount == 0 {
+			// the existing objects are read.
+			if len(args) != 0 {
+				fmt.Println("Usage: ./minio-perftest -mode get [flags], or -mode get -prepopulate N [flags] UPLOADS_SIZE")
+				os.Exit(1)
+			}
+			break
+		}
+		if sizeReps > 0 {
+			if len(args) != 0 || sizesFromStdin {
+				fmt.Println("Usage: ./minio-perftest -size-reps N [flags]")
+				os.Exit(1)
+			}
+			size = sizeReps * int64(len(alNum))
+			break
+		}
+		if sizesFromStdin {
+			if len(args) != 0 {
+				fmt.Println("Usage: ./minio-perftest -sizes-from-stdin [flags] < SIZES_FILE")
+				os.Exit(1)
+			}
+			break
+		}
+		if len(args) != 1 {
+			fmt.Println("Usage: ./minio-perftest [flags] UPLOADS_SIZE")
+			os.Exit(1)
+		}
+
+		// parse command line argument - "-" means to read it
+		// from stdin.
+		if args[0] == "-" {
+			size, err = readSizeLine(os.Stdin)
+		} else {
+			objSizeRange, err = parseSizeRange(args[0])
+			// the largest size bounds the number of distinct
+			// objects.
+			size = objSizeRange.max
+		}
+		if err != nil {
+			if args[0] == "-" {
+				fmt.Println(err)
+			}
+			fmt.Println("Usage: ./minio-perftest [flags] UPLOADS_SIZE")
+			fmt.Println("\nUPLOADS_SIZE examples: 100, 1MB, 10KiB, 1KiB-1MiB, etc")
+			os.Exit(1)
+		}
+	case modeListIncomplete:
+		if len(args) != 0 {
+			fmt.Println("Usage: ./minio-perftest -mode list-incomplete [flags]")
+			os.Exit(1)
+		}
+	case modeRestore:
+		if len(args) != 0 {
+			fmt.Println("Usage: ./minio-perftest -mode restore [flags]")
+			os.Exit(1)
+		}
+	case modeTiny:
+		// objects are empty unless a size is given.
+		if len(args) == 1 {
+			objSizeRange, err = parseSizeRange(args[0])
+			size = objSizeRange.max
+		}
+		if len(args) > 1 || err != nil || size > tinyMaxSize {
+			fmt.Println("Usage: ./minio-perftest -mode tiny [flags] [UPLOADS_SIZE]")
+			fmt.Printf("\nUPLOADS_SIZE is at most %v bytes, e.g. 0, 1 or 0-16\n", tinyMaxSize)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println("Unknown -mode given:", mode)
+		os.Exit(1)
+	}
+
+	if mode == modeMixed {
+		if sizesFromStdin {
+			fmt.Println("-sizes-from-stdin is not supported in mixed mode")
+			os.Exit(1)
+		}
+		workload, err = parseWorkload(workloadSpec)
+		if err != nil {
+			fmt.Println("Invalid -workload given:", err)
+			os.Exit(1)
+		}
+	}
+	thinkTime, err = parseDurationRange(thinkTimeSpec)
+	if err != nil {
+		fmt.Println("Invalid -think-time given:", thinkTimeSpec)
+		os.Exit(1)
+	}
+	if sizePrefixSpec != "" {
+		if sizePrefixes, err = parseSizePrefixes(sizePrefixSpec); err != nil {
+			fmt.Println("Invalid -size-prefix given:", err)
+			os.Exit(1)
+		}
+		sizeThreshold, err = parseHumanNumber(sizeThresholdStr)
+		if err != nil || sizeThreshold <= 0 {
+			fmt.Println("Invalid -size-threshold given:", sizeThresholdStr)
+			os.Exit(1)
+		}
+	}
+	if mode == modeVersions {
+		switch {
+		case versionKeyCount < 1 || versionCount < 1:
+			fmt.Println("-version-keys and -versions must be at least 1")
+			os.Exit(1)
+		case sizesFromStdin || partSizeStr != "" || abortRate > 0:
+			fmt.Println("The versions mode does not support -sizes-from-stdin, -part-size and -abort-rate")
+			os.Exit(1)
+		}
+	}
+	if mode == modeDeleteMarkers && (sizesFromStdin || partSizeStr != "" || abortRate > 0 ||
+		hotspotKey != "" || keyTemplateSpec != "") {
+		fmt.Println("The delete-markers mode does not support -sizes-from-stdin, -part-size, -abort-rate, -hotspot-key and -key-template")
+		os.Exit(1)
+	}
+	if mode == modeReadAfterWrite && (sizesFromStdin || partSizeStr != "" || abortRate > 0 ||
+		hotspotKey != "" || keyTemplateSpec != "") {
+		fmt.Println("The read-after-write mode does not support -sizes-from-stdin, -part-size, -abort-rate, -hotspot-key and -key-template")
+		os.Exit(1)
+	}
+	if mode == modeTiny && (sizesFromStdin || sizeReps > 0 || partSizeStr != "" || abortRate > 0 || hotspotKey != "" ||
+		keyTemplateSpec != "" || sizePrefixSpec != "" || recordManifest()) {
+		fmt.Println("The tiny mode does not support -sizes-from-stdin, -size-reps, -part-size, -abort-rate, -hotspot-key, -key-template, -size-prefix, -manifest, -audit and -check-size")
+		os.Exit(1)
+	}
+	if visibilityPoll < 0 || visibilityTimeout <= 0 {
+		fmt.Println("-visibility-poll must not be negative and -visibility-timeout must be positive")
+		os.Exit(1)
+	}
+	if mode == modeRestore && (restoreDays < 1 || restorePoll <= 0 || restoreTimeout <= 0) {
+		fmt.Println("-restore-days, -restore-poll and -restore-timeout must be positive")
+		os.Exit(1)
+	}
+	if deleteVersions && mode != modeDeleteMarkers {
+		fmt.Println("-delete-versions is only supported in delete-markers mode")
+		os.Exit(1)
+	}
+	if iterationsPerWorker < 0 || (iterationsPerWorker > 0 &&
+		(sizesFromStdin || mode == modeVersions || pregenNameCount > 0)) {
+		fmt.Println("-iterations-per-worker must be a positive number of operations, without -sizes-from-stdin, -pregenerate-names and the versions mode")
+		os.Exit(1)
+	}
+	if pregenNameCount < 0 || (pregenNameCount > 0 && (mode != modePut || sizesFromStdin || hotspotKey != "")) {
+		fmt.Println("-pregenerate-names must be a positive number of objects, in put mode without -sizes-from-stdin and -hotspot-key")
+		os.Exit(1)
+	}
+	if hotspotKey != "" && (mode == modeListIncomplete || mode == modeAttributes || mode == modeVersions ||
+		mode == modePresignedGet || mode == modeRestore || mode == modeGet || mode == modeStat) {
+		fmt.Println("-hotspot-key is not supported in", mode, "mode")
+		os.Exit(1)
+	}
+	if maxKeyLength < 0 {
+		fmt.Println("-max-key-length must not be negative")
+		os.Exit(1)
+	}
+	if maxKeyLength > 0 && (len(hotspotKey) > maxKeyLength || len(targetKey) > maxKeyLength) {
+		fmt.Println("-hotspot-key and -target-key must not be longer than -max-key-length")
+		os.Exit(1)
+	}
+	if keyHashPrefix != "" {
+		keyHashPrefix = strings.ToLower(keyHashPrefix)
+		hashLen := map[string]int{keyHashMD5: 32, keyHashSHA256: 64, keyHashCRC32: 8}[keyHashAlgorithm]
+		switch _, herr := hex.DecodeString(keyHashPrefix + strings.Repeat("0", len(keyHashPrefix)%2)); {
+		case hashLen == 0:
+			fmt.Println("Unknown -hash-algorithm given:", keyHashAlgorithm)
+			os.Exit(1)
+		case herr != nil || len(keyHashPrefix) > hashLen:
+			fmt.Println("Invalid -hash-prefix given:", keyHashPrefix)
+			os.Exit(1)
+		case keyHashAttempts < 1 || keyHashBudget < 1:
+			fmt.Println("-hash-attempts and -hash-budget must be at least 1")
+			os.Exit(1)
+		case keyTemplateSpec != "" || sizePrefixSpec != "" || hotspotKey != "":
+			fmt.Println("-hash-prefix is not supported with -key-template, -size-prefix and -hotspot-key")
+			os.Exit(1)
+		}
+	}
+	if parentDirsFile != "" {
+		if parentDirs, err = readParentDirs(parentDirsFile); err != nil {
+			fmt.Println("Invalid -parent-dirs-file given:", err)
+			os.Exit(1)
+		}
+	}
+	if keyTemplateSpec != "" {
+		objKeyTemplate, err = parseKeyTemplate(keyTemplateSpec)
+		if err != nil {
+			fmt.Println("Invalid -key-template given:", err)
+			os.Exit(1)
+		}
+		if hotspotKey != "" || mode == modeVersions {
+			fmt.Println("-key-template is not supported with -hotspot-key and in versions mode")
+			os.Exit(1)
+		}
+		if !objKeyTemplate.hasPlaceholder("seq") && !objKeyTemplate.hasPlaceholder("rand") {
+			if pregenNameCount > 0 {
+				fmt.Println("-pregenerate-names needs a -key-template with {seq} or {rand}, so that the names are unique")
+				os.Exit(1)
+			}
+			fmt.Println("Warning: -key-template has neither {seq} nor {rand}, so each worker uploads every object under the same name (within a day with {date}).")
+		}
+	}
+	if hotspotKey != "" && sizePrefixes != nil {
+		fmt.Println("-size-prefix is not supported with -hotspot-key")
+		os.Exit(1)
+	}
+	switch {
+	case keyCardinality < 0:
+		fmt.Println("-key-cardinality must not be negative")
+		os.Exit(1)
+	case keyCardinality > 0 && (!generatesNames() || mode == modeVersions || mode == modeDeleteMarkers || mode == modeReadAfterWrite ||
+		mode == modeDelete || (mode == modeGet && prepopulateCount == 0)):
+		fmt.Println("-key-cardinality is not supported in", mode, "mode")
+		os.Exit(1)
+	case keyCardinality > 0 && (keyTemplateSpec != "" || sizePrefixSpec != "" || hotspotKey != "" || pregenNameCount > 0):
+		fmt.Println("-key-cardinality is not supported with -key-template, -size-prefix, -hotspot-key and -pregenerate-names")
+		os.Exit(1)
+	}
+	// the distinct names generated before the test.
+	switch limit := maxDistinctNames(); {
+	case int64(keyCardinality) > limit:
+		fmt.Println("-key-cardinality must be at most", limit, "- the number of distinct names of at most -max-key-length bytes")
+		os.Exit(1)
+	case objKeyTemplate == nil && int64(pregenNameCount) > limit:
+		fmt.Println("-pregenerate-names must be at most", limit, "- the number of distinct names of at most -max-key-length bytes")
+		os.Exit(1)
+	case mode == modeVersions && int64(versionKeyCount) > limit:
+		fmt.Println("-version-keys must be at most", limit, "- the number of distinct names of at most -max-key-length bytes")
+		os.Exit(1)
+	}
+	if hotspotKey != "" && (audit || checkSize) {
+		fmt.Println("-audit and -check-size are not supported with -hotspot-key, as the final content of the key depends on the server's ordering of the writes")
+		os.Exit(1)
+	}
+	if targetKey != "" {
+		switch {
+		case mode != modeProbe && mode != modeMixed && mode != modeAttributes && mode != modePresignedGet && mode != modeGet &&
+			mode != modeStat:
+			fmt.Println("-target-key is only supported in the probe, mixed, attributes, presigned-get, get and stat modes")
+			os.Exit(1)
+		case mode == modeMixed && workload.weightOf(opDelete) > 0:
+			fmt.Println("-target-key is not supported with deletes in the workload")
+			os.Exit(1)
+		}
+	}
+	if (mode == modeAttributes || mode == modePresignedGet || mode == modeStat) && targetKey == "" &&
+		(prepopulateCount == 0 || sizesFromStdin) {
+		fmt.Printf("The %v mode requires -prepopulate with the size of the objects\n", mode)
+		os.Exit(1)
+	}
+	if mode == modeGet && (sizesFromStdin || (emptyBucket && prepopulateCount == 0 && targetKey == "")) {
+		fmt.Println("The get mode does not support -sizes-from-stdin, and requires -prepopulate with -empty-bucket")
+		os.Exit(1)
+	}
+	if mode == modeDelete && (prepopulateCount == 0 || sizesFromStdin || hotspotKey != "" || targetKey != "") {
+		fmt.Println("The delete mode requires -prepopulate with the size of the objects, and does not support -sizes-from-stdin, -hotspot-key and -target-key")
+		os.Exit(1)
+	}
+	if mode == modeSelect {
+		if prepopulateCount == 0 || sizesFromStdin || targetKey != "" || hotspotKey != "" {
+			fmt.Println("The select mode requires -prepopulate with the size of the objects, and does not support -sizes-from-stdin, -target-key and -hotspot-key")
+			os.Exit(1)
+		}
+		if selectFormat != selectCSV && selectFormat != selectJSON {
+			fmt.Println("Unknown -select-format given:", selectFormat)
+			os.Exit(1)
+		}
+		if objSizeRange.min < minSelectSize() {
+			fmt.Printf("In select mode, the objects must be at least %v bytes, for the header and a record\n", minSelectSize())
+			os.Exit(1)
+		}
+	}
+	if prepopulateCount < 0 || (prepopulateCount > 0 && (mode == modeListIncomplete || mode == modeRestore || sizesFromStdin)) {
+		fmt.Println("-prepopulate must be a positive number of objects of the given size")
+		os.Exit(1)
+	}
+	if mode == modeDelete && objKeyTemplate == nil {
+		// each object to delete gets a name of its own.
+		if distinct := maxDistinctNames(); int64(prepopulateCount) > distinct {
+			fmt.Println("In delete mode, -prepopulate must be at most", distinct, "- the number of distinct object names of -max-key-length")
+			os.Exit(1)
+		}
+	}
+	if mode == modeProbe && concurrency != 1 {
+		fmt.Println("Probe mode uses a concurrency of 1.")
+		concurrency = 1
+	}
+	latencyPercentiles, err = parsePercentiles(percentilesSpec)
+	if err != nil {
+		fmt.Println("Invalid -percentiles given:", err)
+		os.Exit(1)
+	}
+	if maxRuntime < 0 || delayStart < 0 || hangDumpAfter < 0 {
+		fmt.Println("-max-runtime, -delay-start and -hang-dump-after must not be negative")
+		os.Exit(1)
+	}
+	if batchSize < 1 || collectors < 1 {
+		fmt.Println("-batch-size and -collectors must be at least 1")
+		os.Exit(1)
+	}
+	if perWorkerDir != "" {
+		if err = os.MkdirAll(perWorkerDir, 0755); err != nil {
+			fmt.Println("Invalid -per-worker-output given:", err)
+			os.Exit(1)
+		}
+	}
+	if compressibility < 0 || compressibility > 1 {
+		fmt.Println("-compressibility must be between 0 and 1")
+		os.Exit(1)
+	}
+	switch contentPattern {
+	case patternRepeating:
+	case patternRandom:
+		// the random pattern is the unique content.
+		uniqueContent = true
+	case patternZeros, patternOnes, patternSequential:
+		if uniqueContent || compressibility > 0 || payloadFile != "" {
+			fmt.Println("-content-pattern", contentPattern, "is not supported with -unique-content, -compressibility and -payload-file")
+			os.Exit(1)
+		}
+	default:
+		fmt.Println("Unknown -content-pattern given:", contentPattern)
+		os.Exit(1)
+	}
+	if payloadFile != "" {
+		if uniqueContent || compressibility > 0 {
+			fmt.Println("-payload-file is not supported with -unique-content and -compressibility")
+			os.Exit(1)
+		}
+		if payload, err = loadPayload(payloadFile); err != nil {
+			fmt.Println("Invalid -payload-file given:", err)
+			os.Exit(1)
+		}
+	}
+	if webhookURL != "" {
+		u, uerr := url.Parse(webhookURL)
+		if uerr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Println("Invalid -webhook-url given:", webhookURL)
+			os.Exit(1)
+		}
+	}
+	if (kafkaBrokersStr == "") != (kafkaTopic == "") {
+		fmt.Println("-kafka-brokers and -kafka-topic must be given together")
+		os.Exit(1)
+	}
+	if kafkaBrokersStr != "" {
+		for _, broker := range strings.Split(kafkaBrokersStr, ",") {
+			broker = strings.TrimSpace(broker)
+			if _, port, serr := net.SplitHostPort(broker); serr != nil || port == "" {
+				fmt.Println("Invalid Kafka broker given:", broker)
+				os.Exit(1)
+			}
+			kafkaBrokers = append(kafkaBrokers, broker)
+		}
+	}
+	buckets = []string{bucket}
+	if bucketsSpec != "" {
+		buckets = nil
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(bucketsSpec, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				fmt.Println("Invalid -buckets given - the buckets must be distinct and not empty:", bucketsSpec)
+				os.Exit(1)
+			}
+			seen[name] = true
+			buckets = append(buckets, name)
+		}
+		bucket = buckets[0]
+	}
+	bucketKeys = []*keySet{liveKeys}
+	for range buckets[1:] {
+		bucketKeys = append(bucketKeys, newKeySet())
+	}
+	if len(buckets) > 1 {
+		switch mode {
+		case modePut, modeTiny, modeMixed, modeGet, modeStat, modeAttributes, modePresignedGet, modeDelete:
+		default:
+			fmt.Println("-buckets is not supported in", mode, "mode")
+			os.Exit(1)
+		}
+		switch {
+		case targetKey != "" || hotspotKey != "" || emptyBucket || cleanupIncomplete || recordManifest() || autoConcurrency:
+			fmt.Println("-buckets is not supported with -target-key, -hotspot-key, -empty-bucket, -cleanup-incomplete, -manifest, -audit, -check-size and -autoconcurrency")
+			os.Exit(1)
+		case concurrency < len(buckets):
+			fmt.Println("-c must be at least the number of -buckets, so that each bucket has a worker")
+			os.Exit(1)
+		case mode != modePut && mode != modeTiny && mode != modeMixed && prepopulateCount < len(buckets):
+			fmt.Printf("The %v mode with -buckets requires -prepopulate with at least one object per bucket\n", mode)
+			os.Exit(1)
+		}
+	}
+	if pauseSignal && !pauseSignalSupported {
+		fmt.Println("-pause-signal is not supported on", runtime.GOOS)
+		os.Exit(1)
+	}
+	if csvSampleRate <= 0 || csvSampleRate > 1 {
+		fmt.Println("-sample-rate must be greater than 0 and at most 1")
+		os.Exit(1)
+	}
+	if maxSamples < 0 || cdfPoints < 0 {
+		fmt.Println("-max-samples and -cdf-points must not be negative")
+		os.Exit(1)
+	}
+	if abortRate < 0 || abortRate > 1 {
+		fmt.Println("-abort-rate must be between 0 and 1")
+		os.Exit(1)
+	}
+	if partSizeStr != "" {
+		partSize, err = parseHumanNumber(partSizeStr)
+		if err != nil || partSize <= 0 {
+			fmt.Println("Invalid -part-size given:", partSizeStr)
+			os.Exit(1)
+		}
+	} else if abortRate > 0 || manualMultipart {
+		partSize = defaultPartSize
+	}
+	if checksumAlgorithm != "" {
+		switch {
+		case checksumAlgorithm != checksumCRC32C && checksumAlgorithm != checksumSHA256 &&
+			checksumAlgorithm != checksumCRC64NVME:
+			fmt.Println("Unknown -checksum given:", checksumAlgorithm)
+			os.Exit(1)
+		case mode != modePut && mode != modeMixed && mode != modeReadAfterWrite:
+			fmt.Println("-checksum is only supported in the put, mixed and read-after-write modes")
+			os.Exit(1)
+		case partSize > 0:
+			fmt.Println("-checksum is not supported with multipart uploads")
+			os.Exit(1)
+		}
+	}
+	if manualMultipart && mode != modePut && mode != modeMixed {
+		fmt.Println("-manual-multipart is only supported in the put and mixed modes")
+		os.Exit(1)
+	}
+	if measureGeneration && mode != modePut && mode != modeMixed {
+		fmt.Println("-measure-generation is only supported in the put and mixed modes")
+		os.Exit(1)
+	}
+	switch {
+	case overwriteRatio < 0 || overwriteRatio > 1:
+		fmt.Println("-overwrite-ratio must be between 0 and 1")
+		os.Exit(1)
+	case overwriteRatio > 0 && mode != modePut && mode != modeMixed:
+		fmt.Println("-overwrite-ratio is only supported in the put and mixed modes")
+		os.Exit(1)
+	case overwriteRatio > 0 && (hotspotKey != "" || pregenNameCount > 0):
+		fmt.Println("-overwrite-ratio is not supported with -hotspot-key and -pregenerate-names")
+		os.Exit(1)
+	}
+	switch timeFormat {
+	case timeFormatNano, timeFormatUnix, timeFormatRFC3339:
+	default:
+		fmt.Println("Unknown -time-format given:", timeFormat)
+		os.Exit(1)
+	}
+	switch plotFormat {
+	case plotGnuplot:
+		if plotFile != "" && csvFile == "" {
+			fmt.Println("-plot with the gnuplot format requires -csv")
+			os.Exit(1)
+		}
+	case plotVegaLite:
+	default:
+		fmt.Println("Unknown -plot-format given:", plotFormat)
+		os.Exit(1)
+	}
+	if recordConcurrency && rateFile == "" && plotFile == "" {
+		fmt.Println("-record-concurrency requires -rate-file or -plot")
+		os.Exit(1)
+	}
+	switch summaryFormat {
+	case summaryText, summaryMarkdown:
+	default:
+		fmt.Println("Unknown -summary-format given:", summaryFormat)
+		os.Exit(1)
+	}
+	if exemplars && metricsAddr == "" {
+		fmt.Println("-exemplars requires -metrics-addr")
+		os.Exit(1)
+	}
+	if metricLabelsSpec != "" && metricsAddr == "" {
+		fmt.Println("-metric-labels requires -metrics-addr")
+		os.Exit(1)
+	}
+	if metricLabels, err = parseMetricLabels(metricLabelsSpec); err != nil {
+		fmt.Println("Invalid -metric-labels given:", err)
+		os.Exit(1)
+	}
+	if dialTimeout < 0 || opTimeout < 0 || dnsRetryTimeout < 0 {
+		fmt.Println("-dial-timeout, -op-timeout and -dns-retry-timeout must not be negative")
+		os.Exit(1)
+	}
+	if queueingFile != "" && maxSamples > 0 {
+		fmt.Println("-queueing-file needs every operation, and cannot be used with -max-samples")
+		os.Exit(1)
+	}
+	if startJitter < 0 {
+		fmt.Println("-start-jitter must not be negative")
+		os.Exit(1)
+	}
+	if maxConsecutiveErrors < 1 {
+		fmt.Println("-max-consecutive-errors must be at least 1")
+		os.Exit(1)
+	}
+	if autoConcurrency {
+		if mode == modeProbe || mode == modeListIncomplete || mode == modeVersions || mode == modeRestore ||
+			mode == modeDelete || sizesFromStdin || iterationsPerWorker > 0 || pregenNameCount > 0 {
+			fmt.Println("-autoconcurrency is not supported in the probe, list-incomplete, versions, restore and delete modes, nor with -sizes-from-stdin, -iterations-per-worker and -pregenerate-names")
+			os.Exit(1)
+		}
+		if autoConcurrencyStep <= 0 || autoConcurrencyGain <= 0 {
+			fmt.Println("-autoconcurrency-step and -autoconcurrency-gain must be positive")
+			os.Exit(1)
+		}
+	}
+	if recordErrorLatency && maxConsecutiveErrors < 2 {
+		fmt.Println("-record-error-latency requires -max-consecutive-errors of 2 or more")
+		os.Exit(1)
+	}
+	if retryBase < 0 || retryMax < 0 || (retryMax > 0 && retryBase > retryMax) {
+		fmt.Println("-retry-base and -retry-max must not be negative, and -retry-base must not be above -retry-max")
+		os.Exit(1)
+	}
+	if sdkRetries < aws.UseServiceDefaultRetries {
+		fmt.Println("-sdk-retries must be -1 or more")
+		os.Exit(1)
+	}
+	if faultInjectSpec != "" {
+		faults, err = parseFaultConfig(faultInjectSpec)
+		if err != nil {
+			fmt.Println("Invalid -fault-inject given:", err)
+			os.Exit(1)
+		}
+		fmt.Println("WARNING: fault injection is enabled - results do not reflect the server's performance.")
+	}
+	if bufferSizeStr != "" {
+		bufferSize, err = parseHumanNumber(bufferSizeStr)
+		if err != nil || bufferSize <= 0 {
+			fmt.Println("Invalid -buffer-size given:", bufferSizeStr)
+			os.Exit(1)
+		}
+	}
+	endpoints, err = parseEndpoints(endpoint, secure)
+	if err != nil {
+		fmt.Println("Invalid -h given:", err)
+		os.Exit(1)
+	}
+	if maxOpenFiles == 0 {
+		maxOpenFiles = neededOpenFiles()
+	}
+	if err = checkOpenFileLimit(maxOpenFiles); err != nil {
+		fmt.Println("Open file limit check failed:", err)
+		os.Exit(1)
+	}
+	workerEndpoints, err = splitWorkers(splitSpec, len(endpoints), concurrency)
+	if err != nil {
+		fmt.Println("Invalid -split given:", err)
+		os.Exit(1)
+	}
+	if endpointsWeighted() && splitSpec != "" {
+		fmt.Println("-split cannot be used with endpoint weights in -h")
+		os.Exit(1)
+	}
+	if err = checkEndpoints(endpoints); err != nil {
+		fmt.Println("Preflight check failed:", err)
+		os.Exit(1)
+	}
+	if adaptive {
+		if adaptiveThreshold < 0 || adaptiveThreshold >= 1 {
+			fmt.Println("-adaptive-threshold must be at least 0 and below 1")
+			os.Exit(1)
+		}
+		limiter = newAdaptiveLimiter(concurrency)
+	}
+	if opRate < 0 {
+		fmt.Println("-rate must not be negative")
+		os.Exit(1)
+	}
+	if rateOpsSpec != "" {
+		if opRate == 0 {
+			fmt.Println("-rate-ops requires -rate")
+			os.Exit(1)
+		}
+		if mode != modeMixed {
+			fmt.Println("-rate-ops is only supported in mixed mode")
+			os.Exit(1)
+		}
+		if rateOps, err = parseRateOps(rateOpsSpec); err != nil {
+			fmt.Println("Invalid -rate-ops given:", err)
+			os.Exit(1)
+		}
+	}
+	if opRate > 0 {
+		rateBucket = newTokenBucket(opRate)
+	}
+	if connStats {
+		conns = &connTracker{}
+	}
+	httpClient = newHTTPClient()
+
+	runID = newRunID()
+	fmt.Println("Run ID:", runID)
+
+	// set random seed for this run
+	rand.Seed(randomSeed)
+
+	if autoConcurrency {
+		concurrency, err = calibrateConcurrency(size, concurrency)
+		if err != nil {
+			fmt.Println("Quit due to errors:", err)
+			os.Exit(1)
+		}
+		if workerEndpoints, err = splitWorkers(splitSpec, len(endpoints), concurrency); err != nil {
+			fmt.Println("Invalid -split given:", err)
+			os.Exit(1)
+		}
+		if adaptive {
+			limiter = newAdaptiveLimiter(concurrency)
+		}
+	}
+
+	var traceOut *os.File
+	if traceFile != "" {
+		traceOut, err = os.Create(traceFile)
+		if err != nil {
+			fmt.Println("Unable to create trace file:", err)
+			os.Exit(1)
+		}
+		if err = trace.Start(traceOut); err != nil {
+			fmt.Println("Unable to start trace:", err)
+			os.Exit(1)
+		}
+	}
+
+	// launch test
+	result, err := launchTest(size)
+
+	if traceOut != nil {
+		trace.Stop()
+		traceOut.Close()
+	}
+
+	if cleanupIncomplete {
+		removed, cerr := removeIncompleteUploads()
+		fmt.Printf("Removed %v incomplete uploads.\n", removed)
+		if cerr != nil {
+			fmt.Println("Error removing incomplete uploads:", cerr)
+		}
+	}
+
+	var uploads manifest
+	if recordManifest() {
+		uploads = result.getManifest()
+	}
+
+	// write all enabled outputs, also if the test failed.
+	var outputs []outputFile
+	if csvFile != "" {
+		outputs = append(outputs, outputFile{csvFile, func(w io.Writer) error {
+			return writeCSVOutputFile(w, &result)
+		}})
+	}
+	if queueingFile != "" {
+		outputs = append(outputs, outputFile{queueingFile, func(w io.Writer) error {
+			return writeQueueingFile(w, &result)
+		}})
+	}
+	if sqliteFile != "" {
+		outputs = append(outputs, outputFile{sqliteFile, func(w io.Writer) error {
+			return writeSQLiteFile(w, &result)
+		}})
+	}
+	if jsonSummaryFile != "" {
+		outputs = append(outputs, outputFile{jsonSummaryFile, func(w io.Writer) error {
+			return writeJSONSummary(w, result.getSummary(err))
+		}})
+	}
+	if rateFile != "" {
+		outputs = append(outputs, outputFile{rateFile, func(w io.Writer) error {
+			return writeRateFile(w, &result)
+		}})
+	}
+	if warpFile != "" {
+		outputs = append(outputs, outputFile{warpFile, func(w io.Writer) error {
+			return writeWarpFile(w, &result)
+		}})
+	}
+	if cdfFile != "" {
+		outputs = append(outputs, outputFile{cdfFile, func(w io.Writer) error {
+			return writeCDFFile(w, &result)
+		}})
+	}
+	if manifestFile != "" {
+		outputs = append(outputs, outputFile{manifestFile, func(w io.Writer) error {
+			return writeManifest(w, uploads)
+		}})
+	}
+	// the CSV file may be written to a fallback location, which
+	// the gnuplot script must refer to.
+	csvPath := csvFile
+	if plotFile != "" {
+		outputs = append(outputs, outputFile{plotFile, func(w io.Writer) error {
+			if plotFormat == plotVegaLite {
+				return writeVegaLiteSpec(w, &result)
+			}
+			absPath, aerr := filepath.Abs(csvPath)
+			if aerr != nil {
+				return aerr
+			}
+			return writeGnuplotScript(w, &result, absPath)
+		}})
+	}
+	for _, out := range outputs {
+		written, werr := writeOutputFile(out.fileName, out.write)
+		if werr != nil {
+			fmt.Printf("Error writing %v: %v\n", out.fileName, werr)
+		} else if out.fileName == csvFile {
+			csvPath = written
+		}
+	}
+
+	if webhookURL != "" {
+		// the notification is best-effort and does not fail the
+		// run.
+		if werr := postWebhook(webhookURL, result.getSummary(err)); werr != nil {
+			fmt.Printf("Error posting the summary to %v: %v\n", webhookURL, werr)
+		}
+	}
+
+	fmt.Print(result.getFaultMessage())
+	fmt.Print(result.getConflictMessage())
+
+	if err != nil {
+		fmt.Println("Quit due to errors:", err)
+		os.Exit(1)
+	}
+
+	if audit {
+		fmt.Printf("Auditing %v uploaded objects...\n", len(uploads.Objects))
+		res, err := checkObjects(uploads, "Audit", auditObject)
+		if err != nil {
+			fmt.Println("Audit failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Audit done: %v objects checked, %v missing, %v corrupt, %v could not be checked.\n",
+			res.checked, res.missing, res.corrupt, res.failed)
+		if auditReportFile != "" {
+			_, werr := writeOutputFile(auditReportFile, func(w io.Writer) error {
+				return writeAuditReport(w, res)
+			})
+			if werr != nil {
+				fmt.Printf("Error writing %v: %v\n", auditReportFile, werr)
+			}
+		}
+	}
+
+	if checkSize {
+		fmt.Printf("Checking the size of %v uploaded objects...\n", len(uploads.Objects))
+		res, err := checkObjects(uploads, "Size check", checkObjectSize)
+		if err != nil {
+			fmt.Println("Size check failed:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Size check done: %v objects checked, %v missing, %v with a wrong size, %v could not be checked.\n",
+			res.checked, res.missing, res.corrupt, res.failed)
+	}
+
+	// in markdown mode, the tables replace the messages with the
+	// totals, latencies, endpoints and operations, and the other
+	// messages follow them.
+	markdown := summaryFormat == summaryMarkdown
+	textOnly := func(msg string) string {
+		if markdown {
+			return ""
+		}
+		return msg
+	}
+	msg := textOnly(result.getTRMessage()) +
+		result.getStaggerMessage() +
+		textOnly(result.getLatencyMessage()) +
+		result.getRateMessage() +
+		result.getPrefixMessage() +
+		result.getVersionMessage() +
+		textOnly(result.getEndpointMessage(true)) +
+		result.getPresignMessage() +
+		result.getMultipartMessage() +
+		result.getRestoreMessage() +
+		result.getVisibilityMessage() +
+		result.getOverwriteMessage() +
+		result.getSelectMessage() +
+		result.getErrorLatencyMessage() +
+		result.getChecksumMessage() +
+		result.getGenerationMessage() +
+		result.getConnMessage() +
+		result.getServerTimingMessage() +
+		result.getAdaptiveMessage() +
+		result.getHealthcheckMessage() +
+		getKeyHashMessage() +
+		getKeyCardinalityMessage() +
+		getKeyLengthMessage() +
+		getRetryMessage() +
+		getDNSMessage()
+	if len(result.opTypes()) > 1 {
+		msg += textOnly(result.getOpMessage())
+	}
+	peakSec, peakCount := result.peakSecond()
+	msg += fmt.Sprintf("Peak ops/s: %v (in second %v of the test).\n", peakCount, peakSec) +
+		fmt.Sprintf("TCP_NODELAY: %v\n", tcpNoDelay) +
+		fmt.Sprintf("Run ID: %v\n", runID)
+	if markdown {
+		if err := writeMarkdownSummary(os.Stdout, result.getSummary(nil)); err != nil {
+			fmt.Println("Error printing the summary:", err)
+			os.Exit(1)
+		}
+		// the warning of the latency message, which the tables
+		// leave out.
+		if samples := len(result.sortedDurations("")); samples > 0 {
+			msg += getPercentileWarning(samples)
+		}
+		// each line is a paragraph.
+		msg = "\n" + strings.ReplaceAll(strings.TrimSuffix(msg, "\n"), "\n", "\n\n") + "\n"
+	}
+	fmt.Print(msg)
 }
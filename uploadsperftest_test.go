@@ -0,0 +1,1249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/parquet-go/parquet-go"
+	"github.com/segmentio/kafka-go"
+)
+
+// readTestWSFrame reads an unmasked WebSocket frame, as sent by the
+// live feed.
+func readTestWSFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("frame header %x: want FIN set and no mask", header)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			t.Fatal(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			t.Fatal(err)
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// maskedWSFrame returns a masked frame, as sent by a client.
+func maskedWSFrame(opcode byte, payload []byte) []byte {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestWSFrameRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 125, 126, 1<<16 - 1, 1 << 16, 1<<16 + 1} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		var b bytes.Buffer
+		if err := writeWSFrame(&b, 0x1, payload); err != nil {
+			t.Fatal(err)
+		}
+		opcode, got := readTestWSFrame(t, &b)
+		if opcode != 0x1 || !bytes.Equal(got, payload) {
+			t.Errorf("length %v: got opcode %v and %v bytes", n, opcode, len(got))
+		}
+		if b.Len() != 0 {
+			t.Errorf("length %v: %v bytes left after the frame", n, b.Len())
+		}
+	}
+}
+
+func TestReadWSFrames(t *testing.T) {
+	// a ping, then a close frame.
+	frames := append(maskedWSFrame(0x9, []byte("ping")), maskedWSFrame(0x8, nil)...)
+	if err := readWSFrames(bytes.NewReader(frames)); err != nil {
+		t.Errorf("close frame: got %v", err)
+	}
+	if err := readWSFrames(bytes.NewReader(maskedWSFrame(0x9, nil))); err != io.EOF {
+		t.Errorf("no close frame: got %v, want EOF", err)
+	}
+
+	// a client announcing a frame of 2^63 bytes.
+	huge := []byte{0x82, 0x80 | 127}
+	huge = binary.BigEndian.AppendUint64(huge, 1<<63)
+	if err := readWSFrames(bytes.NewReader(huge)); err == nil || err == io.EOF {
+		t.Errorf("huge frame: got %v, want an error", err)
+	}
+}
+
+func TestLiveFeed(t *testing.T) {
+	feed, err := startLiveFeed("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.close()
+
+	conn, err := net.Dial("tcp", feed.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// the handshake of the example in RFC 6455.
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("got status %v and accept %q", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// the client is added after the response is sent.
+	for {
+		feed.mu.Lock()
+		clients := len(feed.clients)
+		feed.mu.Unlock()
+		if clients == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	feed.publish([]opSample{{opType: opPut, startTime: start, duration: time.Millisecond, size: 1024}})
+
+	opcode, payload := readTestWSFrame(t, br)
+	var result wsResult
+	if err = json.Unmarshal(payload, &result); err != nil {
+		t.Fatal(err)
+	}
+	want := wsResult{RunID: runID, Op: opPut, StartTime: start, DurationNs: int64(time.Millisecond), Size: 1024}
+	if opcode != 0x1 || result != want {
+		t.Errorf("got opcode %v and %+v, want a text frame with %+v", opcode, result, want)
+	}
+
+	if _, err = conn.Write(maskedWSFrame(0x8, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLiveFeedRejectsPlainRequests(t *testing.T) {
+	feed, err := startLiveFeed("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.close()
+	resp, err := http.Get("http://" + feed.listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "WebSocket") {
+		t.Errorf("got status %v and body %q", resp.StatusCode, body)
+	}
+}
+
+// testObject returns an object of the given size with a content seed
+// from the given seed.
+func testObject(seed int64, size int64) ObjGen {
+	seedBytes := []byte(getAlNumPerm(rand.New(rand.NewSource(seed))))
+	return newObjGen("test", size, seedBytes)
+}
+
+func TestCompressibility(t *testing.T) {
+	defer func(saved float64) { compressibility = saved }(compressibility)
+	const size = 4 << 20
+	for _, c := range []float64{0.25, 0.5, 0.75} {
+		compressibility = c
+		og := testObject(1, size)
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		n, err := io.Copy(zw, &og)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n != size {
+			t.Fatalf("compressibility %v: read %v bytes, want %v", c, n, size)
+		}
+		// the compressible part shrinks to almost nothing, and
+		// the random part does not shrink.
+		saved := 1 - float64(b.Len())/size
+		if saved < c-0.05 || saved > c+0.05 {
+			t.Errorf("compressibility %v: gzip saved %.3f of the size", c, saved)
+		}
+	}
+}
+
+func TestSameSeedWorkload(t *testing.T) {
+	defer func(saved []string, savedRange sizeRange) {
+		randObjNames, objSizeRange = saved, savedRange
+	}(randObjNames, objSizeRange)
+	randObjNames = []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	var err error
+	if objSizeRange, err = parseSizeRange("1KiB-1MiB"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sizes, names and content seeds of the uploads of a
+	// worker, whose random source is seeded like in a run.
+	workload := func(seed int64) []ObjGen {
+		workerRand := rand.New(rand.NewSource(seed))
+		var objects []ObjGen
+		for i := 0; i < 1000; i++ {
+			object, err := NewRandomObjectWithSize(workerRand, pickObjectSize(workerRand, objSizeRange.max))
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects = append(objects, object)
+		}
+		return objects
+	}
+	first, second := workload(42), workload(42)
+	sizes := make(map[int64]bool)
+	for i := range first {
+		a, b := first[i], second[i]
+		if a.ObjectSize != b.ObjectSize || a.ObjectName != b.ObjectName || !bytes.Equal(a.SeedBytes, b.SeedBytes) {
+			t.Fatalf("upload %v differs: %v bytes as %v, and %v bytes as %v",
+				i, a.ObjectSize, a.ObjectName, b.ObjectSize, b.ObjectName)
+		}
+		if a.ObjectSize < objSizeRange.min || a.ObjectSize > objSizeRange.max {
+			t.Fatalf("upload %v: size %v is out of the range", i, a.ObjectSize)
+		}
+		sizes[a.ObjectSize] = true
+	}
+	if len(sizes) < 2 {
+		t.Errorf("all uploads have the same size")
+	}
+	if other := workload(43); other[0].ObjectSize == first[0].ObjectSize && other[1].ObjectSize == first[1].ObjectSize {
+		t.Errorf("another seed gave the same sizes")
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	for _, tc := range []struct {
+		host, want string
+	}{
+		{"localhost", "localhost"},
+		{"localhost:9000", "localhost:9000"},
+		{"10.0.0.1:9000", "10.0.0.1:9000"},
+		{"[::1]:9000", "[::1]:9000"},
+		{"[::1]", "[::1]"},
+		{"::1", "[::1]"},
+		{"2001:db8::1", "[2001:db8::1]"},
+		// without brackets, the last group is part of the address.
+		{"::1:9000", "[::1:9000]"},
+		{"[fe80::1%eth0]:9000", "[fe80::1%25eth0]:9000"},
+		{"fe80::1%eth0", "[fe80::1%25eth0]"},
+		{"", ""},
+		{"[::1]:", ""},
+		{":9000", ""},
+		{"[::g]:9000", ""},
+		{"[fe80::1%]:9000", ""},
+		{"a:b:c", ""},
+	} {
+		got, err := normalizeHost(tc.host)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("normalizeHost(%q) = %q, want an error", tc.host, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("normalizeHost(%q) = %q, %v, want %q", tc.host, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseEndpointsIPv6(t *testing.T) {
+	for _, tc := range []struct {
+		spec   string
+		secure bool
+		want   []string
+	}{
+		{"[::1]:9000", false, []string{"http://[::1]:9000"}},
+		{"::1", true, []string{"https://[::1]"}},
+		{"http://[fe80::1%25eth0]:9000", true, []string{"http://[fe80::1%25eth0]:9000"}},
+		{"[fe80::1%25eth0]:9000", false, []string{"http://[fe80::1%25eth0]:9000"}},
+		{"[::1]:9000, 10.0.0.1:9000,https://[2001:db8::1]:443,localhost", false,
+			[]string{"http://[::1]:9000", "http://10.0.0.1:9000", "https://[2001:db8::1]:443", "http://localhost"}},
+		{"[::1]:9000=3,127.0.0.1:9000", false, []string{"http://[::1]:9000", "http://127.0.0.1:9000"}},
+	} {
+		eps, err := parseEndpoints(tc.spec, tc.secure)
+		if err != nil {
+			t.Errorf("parseEndpoints(%q): %v", tc.spec, err)
+			continue
+		}
+		var got []string
+		for _, ep := range eps {
+			got = append(got, ep.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("parseEndpoints(%q) = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+
+	// the SDK parses the endpoint as a URL.
+	eps, err := parseEndpoints("http://[fe80::1%25eth0]:9000", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(eps[0].String())
+	if err != nil || u.Hostname() != "fe80::1%eth0" || u.Port() != "9000" {
+		t.Errorf("endpoint URL %v: got %v, host %q and port %q", eps[0], err, u.Hostname(), u.Port())
+	}
+
+	eps, err = parseEndpoints("[::1]:9000=3,127.0.0.1:9000", false)
+	if err != nil || eps[0].weight != 3 || eps[1].weight != 1 {
+		t.Errorf("weighted endpoints: got %+v, %v", eps, err)
+	}
+	for _, spec := range []string{"[::1]:9000,[::g]:9000", "ftp://[::1]:21", "http://[::1]:9000/path"} {
+		if _, err := parseEndpoints(spec, false); err == nil {
+			t.Errorf("parseEndpoints(%q): want an error", spec)
+		}
+	}
+}
+
+func TestCheckEndpointsIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("no IPv6 loopback:", err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	eps, err := parseEndpoints("http://[::1]:"+port+",[0:0::1]:"+port, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkEndpoints(eps); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParquetStream(t *testing.T) {
+	savedRunID := runID
+	defer func() { runID = savedRunID }()
+	runID = "test-run"
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	succeeded := []opSample{
+		{opType: "put", startTime: start, duration: 15 * time.Millisecond, size: 1 << 20, workerID: 3},
+		{opType: "get", startTime: start.Add(time.Second), duration: 2 * time.Millisecond, size: 4096, workerID: 0},
+	}
+	failed := []opSample{
+		{opType: "delete", startTime: start.Add(2 * time.Second), duration: time.Second, workerID: 7},
+	}
+
+	fileName := filepath.Join(t.TempDir(), "ops.parquet")
+	ps, err := startParquetStream(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.write(succeeded, true)
+	ps.write(nil, true)
+	ps.write(failed, false)
+	if err := ps.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := parquet.ReadFile[parquetRow](fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []parquetRow{
+		{StartTime: start, Op: "put", DurationNs: int64(15 * time.Millisecond), Size: 1 << 20, WorkerID: 3, Success: true},
+		{StartTime: start.Add(time.Second), Op: "get", DurationNs: int64(2 * time.Millisecond), Size: 4096, WorkerID: 0, Success: true},
+		{StartTime: start.Add(2 * time.Second), Op: "delete", DurationNs: int64(time.Second), WorkerID: 7},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("read %v rows, want %v", len(rows), len(want))
+	}
+	for i := range want {
+		if !rows[i].StartTime.Equal(want[i].StartTime) {
+			t.Errorf("row %v: start time %v, want %v", i, rows[i].StartTime, want[i].StartTime)
+		}
+		rows[i].StartTime = want[i].StartTime
+		if rows[i] != want[i] {
+			t.Errorf("row %v: %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := pf.Lookup("minio-perftest.runId"); !ok || id != "test-run" {
+		t.Errorf("run ID %q (found: %v), want %q", id, ok, "test-run")
+	}
+	var columns []string
+	for _, field := range pf.Schema().Fields() {
+		columns = append(columns, field.Name())
+	}
+	if got := strings.Join(columns, ","); got != "start_time,op,duration_ns,size,worker_id,success" {
+		t.Errorf("columns %v", got)
+	}
+}
+
+func TestClampKey(t *testing.T) {
+	defer func(saved int) { maxKeyLength = saved }(maxKeyLength)
+	maxKeyLength = 8
+
+	tests := []struct {
+		key, want string
+	}{
+		// at the limit, and one byte over it.
+		{"abcdefgh", "abcdefgh"},
+		{"abcdefghi", "abcdefgh"},
+		// "é" takes the 8th and 9th bytes, and is dropped whole.
+		{"abcdefgé", "abcdefg"},
+		{"abcdeféh", "abcdefé"},
+		// a slash left at the end is trimmed.
+		{"abcdefg/hij", "abcdefg"},
+		{"abc/////xyz", "abc"},
+	}
+	for _, test := range tests {
+		got, err := clampKey(test.key)
+		if err != nil {
+			t.Errorf("%q: %v", test.key, err)
+		} else if got != test.want {
+			t.Errorf("%q: clamped to %q, want %q", test.key, got, test.want)
+		}
+	}
+
+	// nothing is left of these names.
+	for _, key := range []string{"////////abc", "/////////"} {
+		if got, err := clampKey(key); err == nil {
+			t.Errorf("%q: clamped to %q, want an error", key, got)
+		}
+	}
+	maxKeyLength = 1
+	if got, err := clampKey("éa"); err == nil {
+		t.Errorf("clamped to %q, want an error", got)
+	}
+
+	maxKeyLength = 0
+	long := strings.Repeat("a", 2000)
+	if got, err := clampKey(long); err != nil || got != long {
+		t.Errorf("without a limit, clamped to %v bytes (%v)", len(got), err)
+	}
+}
+
+// kafkaTestWriter records the batches written to it, or fails them
+// with err.
+type kafkaTestWriter struct {
+	err     error
+	batches [][]kafka.Message
+	closed  bool
+}
+
+func (w *kafkaTestWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.batches = append(w.batches, msgs)
+	return nil
+}
+
+func (w *kafkaTestWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafkaProducer(t *testing.T) {
+	start := time.Unix(1700000000, 0).UTC()
+	samples := make([]opSample, kafkaBatchSize+1)
+	for i := range samples {
+		samples[i] = opSample{opType: opPut, startTime: start, duration: time.Millisecond, size: 1024}
+	}
+
+	w := &kafkaTestWriter{}
+	kp := startKafkaWriter(w, "perftest")
+	kp.publish(samples)
+	kp.close()
+	// a full batch, and the rest when the producer is closed.
+	if len(w.batches) != 2 || len(w.batches[0]) != kafkaBatchSize || len(w.batches[1]) != 1 {
+		t.Fatalf("%v batches written", len(w.batches))
+	}
+	if !w.closed {
+		t.Error("writer not closed")
+	}
+	if kp.sent != int64(len(samples)) || kp.dropped != 0 {
+		t.Errorf("%v sent, %v dropped", kp.sent, kp.dropped)
+	}
+	msg := w.batches[1][0]
+	var result wsResult
+	if err := json.Unmarshal(msg.Value, &result); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key != nil || !msg.Time.Equal(start) || result.Op != opPut || result.DurationNs != int64(time.Millisecond) || result.Size != 1024 {
+		t.Errorf("message %+v with %+v", msg, result)
+	}
+
+	// batches that cannot be delivered are dropped.
+	w = &kafkaTestWriter{err: errors.New("no brokers")}
+	kp = startKafkaWriter(w, "perftest")
+	kp.publish(samples[:10])
+	kp.close()
+	if kp.sent != 0 || kp.dropped != 10 {
+		t.Errorf("%v sent, %v dropped, want 10 dropped", kp.sent, kp.dropped)
+	}
+}
+
+func TestNewKafkaWriter(t *testing.T) {
+	w := newKafkaWriter([]string{"kafka1:9092", "kafka2:9092"}, "perftest")
+	if w.Topic != "perftest" || w.Addr.String() != "kafka1:9092,kafka2:9092" {
+		t.Errorf("writer to %v of %v", w.Topic, w.Addr)
+	}
+	if rr, ok := w.Balancer.(*kafka.RoundRobin); !ok || rr.ChunkSize != kafkaBatchSize {
+		t.Errorf("balancer %#v", w.Balancer)
+	}
+	if w.RequiredAcks != kafka.RequireOne || w.Compression != 0 {
+		t.Errorf("acks %v, compression %v", w.RequiredAcks, w.Compression)
+	}
+}
+
+func TestContentPatterns(t *testing.T) {
+	defer func(savedPattern string, savedUnique bool) {
+		contentPattern, uniqueContent = savedPattern, savedUnique
+	}(contentPattern, uniqueContent)
+
+	const size = 5000
+	seedBytes := []byte(getAlNumPerm(rand.New(rand.NewSource(1))))
+	tests := []struct {
+		pattern string
+		// checks the content of the object.
+		check func(content []byte) bool
+	}{
+		{patternZeros, func(content []byte) bool {
+			return bytes.Count(content, []byte{0}) == len(content)
+		}},
+		{patternOnes, func(content []byte) bool {
+			return bytes.Count(content, []byte{0xff}) == len(content)
+		}},
+		{patternSequential, func(content []byte) bool {
+			for i, b := range content {
+				if b != byte(i) {
+					return false
+				}
+			}
+			return true
+		}},
+		{patternRepeating, func(content []byte) bool {
+			for i, b := range content {
+				if b != seedBytes[i%len(seedBytes)] {
+					return false
+				}
+			}
+			return true
+		}},
+		{patternRandom, func(content []byte) bool {
+			// neither the seed repeated nor a run of a single
+			// byte.
+			n := len(seedBytes)
+			return !bytes.Equal(content[:n], content[n:2*n]) &&
+				!bytes.Equal(content[:n], seedBytes) &&
+				bytes.Count(content, content[:1]) < len(content)/16
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			contentPattern, uniqueContent = test.pattern, test.pattern == patternRandom
+			object := newObjGen("test", size, seedBytes)
+
+			// read in chunks that do not divide the size.
+			var content []byte
+			buf := make([]byte, 777)
+			for {
+				n, err := object.Read(buf)
+				content = append(content, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(content) != size {
+				t.Fatalf("read %v bytes, want %v", len(content), size)
+			}
+			if !test.check(content) {
+				t.Errorf("unexpected content %x...", content[:32])
+			}
+
+			// the same content read again from an offset, through
+			// the read index and through ReadAt.
+			const off = 1234
+			if _, err := object.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(&object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rest, content[off:]) {
+				t.Errorf("content read from offset %v differs", off)
+			}
+			at := make([]byte, 1000)
+			if n, err := object.ReadAt(at, off+1); n != len(at) || err != nil {
+				t.Fatalf("ReadAt read %v bytes: %v", n, err)
+			}
+			if !bytes.Equal(at, content[off+1:off+1+len(at)]) {
+				t.Errorf("content read at offset %v differs", off+1)
+			}
+			if n, err := object.ReadAt(at, size-10); n != 10 || err != io.EOF {
+				t.Errorf("ReadAt at the end read %v bytes: %v", n, err)
+			}
+		})
+	}
+}
+
+func TestKeyLengthCount(t *testing.T) {
+	defer func(saved int, savedTruncated map[string]bool) {
+		maxKeyLength, truncatedNames = saved, savedTruncated
+		keysNamed, keysTruncated = 0, 0
+	}(maxKeyLength, truncatedNames)
+	maxKeyLength, truncatedNames = 4, make(map[string]bool)
+	keysNamed, keysTruncated = 0, 0
+
+	markTruncated("abcd")
+	for _, test := range []struct {
+		prefix, name, want string
+	}{
+		{"", "abc", "abc"},
+		// truncated after the prefix.
+		{"p/", "abc", "p/ab"},
+		// the generated name was truncated already.
+		{"", "abcd", "abcd"},
+	} {
+		if key, err := objectKey(test.prefix, test.name); err != nil || key != test.want {
+			t.Errorf("%q + %q: key %q, %v, want %q", test.prefix, test.name, key, err, test.want)
+		}
+	}
+	// each object counts once, also if its name was truncated and
+	// its key again.
+	if _, err := newNamedObject([]byte("seed"), 1, "abcdefgh"); err != nil {
+		t.Fatal(err)
+	}
+	if keysNamed != 4 || keysTruncated != 3 {
+		t.Errorf("%v of %v keys truncated, want 3 of 4", keysTruncated, keysNamed)
+	}
+	if msg := getKeyLengthMessage(); !strings.Contains(msg, "3 of 4 object names (75.0%)") {
+		t.Errorf("message %q", msg)
+	}
+}
+
+func TestNewUniqueNames(t *testing.T) {
+	defer func(savedDirs []string, savedLength int) {
+		parentDirs, maxKeyLength = savedDirs, savedLength
+	}(parentDirs, maxKeyLength)
+	parentDirs, maxKeyLength = []string{""}, 1
+
+	// at most the 10 digits are left of the names.
+	if limit := maxDistinctNames(); limit != 10 {
+		t.Errorf("at most %v distinct names, want 10", limit)
+	}
+	names, err := newUniqueNames(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if len(name) != 1 || seen[name] {
+			t.Errorf("names %q are not 5 distinct digits", names)
+			break
+		}
+		seen[name] = true
+	}
+	if names, err := newUniqueNames(11); err == nil {
+		t.Errorf("found 11 distinct names %q", names)
+	}
+
+	// the numbers of up to 5 digits, and those of 1 digit under
+	// the dir "a/b".
+	parentDirs, maxKeyLength = []string{"", "a b"}, 5
+	if limit := maxDistinctNames(); limit != 111110+10 {
+		t.Errorf("at most %v distinct names, want %v", limit, 111110+10)
+	}
+	maxKeyLength = 0
+	if limit := maxDistinctNames(); limit != math.MaxInt64 {
+		t.Errorf("at most %v distinct names without a limit", limit)
+	}
+}
+
+func TestNewUnusedName(t *testing.T) {
+	defer func(savedDirs []string, savedLength int, savedUsed map[string]bool) {
+		parentDirs, maxKeyLength, usedNames = savedDirs, savedLength, savedUsed
+	}(parentDirs, maxKeyLength, usedNames)
+	// only the names "p0" to "p9" are left.
+	parentDirs, maxKeyLength, usedNames = []string{""}, 2, make(map[string]bool)
+
+	seen := make(map[string]bool)
+	var err error
+	for i := 0; i < 11 && err == nil; i++ {
+		var name string
+		if name, err = newUnusedName("p"); err == nil {
+			if len(name) != 2 || name[0] != 'p' || seen[name] {
+				t.Fatalf("name %q after %v", name, seen)
+			}
+			seen[name] = true
+		}
+	}
+	if err == nil {
+		t.Errorf("found 11 unused names %v", seen)
+	}
+}
+
+func TestSQLiteFile(t *testing.T) {
+	savedRunID := runID
+	defer func() { runID = savedRunID }()
+	runID = "test-run"
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, rows := range []int{0, 1, 1000} {
+		var tr TestResult
+		for i := 0; i < rows; i++ {
+			sample := opSample{
+				opType:    []string{opPut, opGet}[i%2],
+				startTime: start.Add(time.Duration(i) * time.Millisecond),
+				duration:  time.Duration(i%1000) * time.Microsecond,
+				size:      int64(i),
+				workerID:  i % 16,
+			}
+			if i%10 == 9 {
+				tr.failed = append(tr.failed, sample)
+			} else {
+				tr.samples = append(tr.samples, sample)
+			}
+		}
+		fileName := filepath.Join(t.TempDir(), "ops.db")
+		if _, err := writeOutputFile(fileName, func(w io.Writer) error {
+			return writeSQLiteFile(w, &tr)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err := sql.Open("sqlite", fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var check, id string
+		var count, failed, puts, maxSize, maxWorker, firstTen sql.NullInt64
+		err = db.QueryRow("PRAGMA integrity_check").Scan(&check)
+		if err == nil {
+			err = db.QueryRow("SELECT COUNT(*), COUNT(*) - SUM(success), SUM(op = 'put'), MAX(size), MAX(worker_id) FROM operations").
+				Scan(&count, &failed, &puts, &maxSize, &maxWorker)
+		}
+		if err == nil {
+			err = db.QueryRow("SELECT id FROM run").Scan(&id)
+		}
+		if err == nil {
+			err = db.QueryRow("SELECT COUNT(*) FROM operations WHERE start_time <= (SELECT MIN(start_time) FROM operations) + 9999999").
+				Scan(&firstTen)
+		}
+		db.Close()
+		if err != nil {
+			t.Fatalf("%v rows: %v", rows, err)
+		}
+		got := fmt.Sprintf("%v %v|%v|%v|%v|%v %v %v", check, count.Int64, failed.Int64, puts.Int64,
+			maxSize.Int64, maxWorker.Int64, id, firstTen.Int64)
+		want := "ok 0|0|0|0|0 test-run 0"
+		if rows > 0 {
+			wantWorker := 15
+			if rows < 16 {
+				wantWorker = rows - 1
+			}
+			wantFirst := 10
+			if rows < 10 {
+				wantFirst = rows
+			}
+			want = fmt.Sprintf("ok %v|%v|%v|%v|%v test-run %v",
+				rows, rows/10, (rows+1)/2, rows-1, wantWorker, wantFirst)
+		}
+		if got != want {
+			t.Errorf("%v rows: queried %q, want %q", rows, got, want)
+		}
+	}
+}
+
+func TestCSVComments(t *testing.T) {
+	savedRunID, savedComments := runID, csvComments
+	defer func() { runID, csvComments = savedRunID, savedComments }()
+	runID = "test-run"
+
+	var tr TestResult
+	tr.samples = []opSample{{opType: opPut, startTime: time.Unix(1, 0), duration: time.Millisecond, size: 10}}
+	for _, comments := range []bool{false, true} {
+		csvComments = comments
+		var buf bytes.Buffer
+		if err := writeCSVOutputFile(&buf, &tr); err != nil {
+			t.Fatal(err)
+		}
+		r := csv.NewReader(bytes.NewReader(buf.Bytes()))
+		if comments {
+			r.Comment = '#'
+		}
+		records, err := r.ReadAll()
+		if err != nil {
+			t.Fatalf("comments %v: %v", comments, err)
+		}
+		if len(records) != 2 || !reflect.DeepEqual(records[0], csvColumns()) {
+			t.Errorf("comments %v: read %q", comments, records)
+		}
+		if got := strings.HasPrefix(buf.String(), "# minio-perftest run test-run\n"); got != comments {
+			t.Errorf("comments %v: output starts with the run ID comment: %v", comments, got)
+		}
+	}
+}
+
+func TestReadSizes(t *testing.T) {
+	if size, err := readSizeLine(strings.NewReader("10KiB\n20\n")); err != nil || size != 10240 {
+		t.Errorf("readSizeLine: %v, %v; want 10240", size, err)
+	}
+	if _, err := readSizeLine(strings.NewReader("-5\n")); err == nil || err.Error() != `negative size "-5" on line 1 of stdin` {
+		t.Errorf("readSizeLine of a negative size: %v", err)
+	}
+
+	for _, tc := range []struct {
+		input string
+		sizes []int64
+		err   string
+	}{
+		{"1\n\n2KB\n0\n", []int64{1, 2000, 0}, ""},
+		{"1\n\n-1KB\n3\n", []int64{1}, `negative size "-1KB" on line 3 of stdin`},
+		{"1\nfoo\n", []int64{1}, `invalid size "foo" on line 2 of stdin`},
+	} {
+		sizeCh := make(chan int64)
+		errCh := make(chan error, 1)
+		go readSizes(strings.NewReader(tc.input), sizeCh, errCh)
+		var sizes []int64
+		for size := range sizeCh {
+			sizes = append(sizes, size)
+		}
+		var errMsg string
+		select {
+		case err := <-errCh:
+			errMsg = err.Error()
+		default:
+		}
+		if !reflect.DeepEqual(sizes, tc.sizes) || errMsg != tc.err {
+			t.Errorf("%q: read %v, %q; want %v, %q", tc.input, sizes, errMsg, tc.sizes, tc.err)
+		}
+	}
+}
+
+// benchmarkCollection runs b.N uploads of 1KiB objects spread over
+// the workers and collects their results as launchTest does: each
+// worker sends its results once it has batch of them, through the
+// given number of collectors. A batch of 1 sends a message per
+// operation, as workers did before they aggregated their results.
+func benchmarkCollection(b *testing.B, workers, batch, numCollectors int) {
+	savedEndpoints := endpoints
+	defer func() { endpoints = savedEndpoints }()
+	endpoints = []s3Endpoint{{host: "localhost:9000"}}
+
+	var tr TestResult
+	tr.manifest = make(map[string]manifestEntry)
+	tr.opCounts = make(map[string]int64)
+	tr.conflicts = make(map[string]int64)
+	tr.prefixes = make(map[string]*prefixStats)
+	tr.endpointStats = make([]endpointStats, len(endpoints))
+	tr.startTime = time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	workerMsgCh := make(chan workerMsg)
+	shardChs := make([]chan workerMsg, numCollectors)
+	for i := range shardChs {
+		shardChs[i] = workerMsgCh
+		if numCollectors > 1 {
+			shardChs[i] = make(chan workerMsg)
+			go collectShard(shardChs[i], (workers-i+numCollectors-1)/numCollectors, workerMsgCh)
+		}
+	}
+	for w := 0; w < workers; w++ {
+		go func(workerID int, msgCh chan<- workerMsg) {
+			stats := newWorkerStats(workerID)
+			for i := workerID; i < b.N; i += workers {
+				stats.add(workerMsg{
+					opType:       opPut,
+					objectSize:   1024,
+					putStartTime: tr.startTime.Add(time.Duration(i) * time.Microsecond),
+					putDuration:  time.Millisecond,
+				}, tr.startTime)
+				if len(stats.samples) >= batch {
+					msgCh <- workerMsg{stats: stats}
+					stats = newWorkerStats(workerID)
+				}
+			}
+			msgCh <- workerMsg{exitingErr: errWorkerSucc, stats: stats}
+		}(w, shardChs[w%numCollectors])
+	}
+	for quit := 0; quit < workers; {
+		msg := <-workerMsgCh
+		if msg.stats != nil {
+			tr.addStats(msg.stats)
+		}
+		if msg.exitingErr != nil {
+			quit++
+		}
+	}
+	b.StopTimer()
+	var secondTotal int64
+	for _, count := range tr.secondCount {
+		secondTotal += count
+	}
+	if tr.objectCount != int64(b.N) || secondTotal != int64(b.N) || len(tr.samples) != b.N {
+		b.Fatalf("collected %v operations, %v in the seconds and %v samples, want %v",
+			tr.objectCount, secondTotal, len(tr.samples), b.N)
+	}
+}
+
+// BenchmarkCollectResults compares sending a message per operation
+// with aggregating the results in the workers, with 200 workers.
+func BenchmarkCollectResults(b *testing.B) {
+	for _, batch := range []int{1, 100} {
+		for _, numCollectors := range []int{1, 4} {
+			b.Run(fmt.Sprintf("batch=%v/collectors=%v", batch, numCollectors), func(b *testing.B) {
+				benchmarkCollection(b, 200, batch, numCollectors)
+			})
+		}
+	}
+}
+
+// BenchmarkBatchSize measures the effect of -batch-size on the
+// collection of the results of 200 workers uploading 1KiB objects.
+func BenchmarkBatchSize(b *testing.B) {
+	for _, batch := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%v", batch), func(b *testing.B) {
+			benchmarkCollection(b, 200, batch, 1)
+		})
+	}
+}
+
+func TestKeySetTake(t *testing.T) {
+	ks := newKeySet()
+	r := rand.New(rand.NewSource(1))
+	ks.add("a")
+	key, count, ok := ks.randomCounted(r)
+	if !ok || key != "a" || count != 0 {
+		t.Fatalf("randomCounted: %q, %v, %v", key, count, ok)
+	}
+	if taken, ok := ks.take(r); !ok || taken != "a" {
+		t.Fatalf("take: %q, %v", taken, ok)
+	}
+	if !ks.takenSince("a", count) {
+		t.Error("a is not taken since it was picked")
+	}
+	// an upload racing with the deletion does not add the key back.
+	ks.add("a")
+	if ks.contains("a") {
+		t.Error("a taken key was added")
+	}
+	ks.done("a")
+	ks.add("a")
+	if !ks.contains("a") {
+		t.Error("a released key was not added")
+	}
+	key, count, _ = ks.randomCounted(r)
+	if ks.takenSince(key, count) {
+		t.Error("a is taken since it was picked again")
+	}
+}
+
+func TestKeySetNewKey(t *testing.T) {
+	defer func(saved []string) { randObjNames = saved }(randObjNames)
+	randObjNames = []string{"a", "b", "c"}
+	ks := newKeySet()
+	r := rand.New(rand.NewSource(1))
+	ks.add("p/a")
+	ks.add("p/b")
+	for i := 0; i < 10; i++ {
+		if key, err := ks.newKey("p/", r); err != nil || key != "p/c" {
+			t.Fatalf("newKey: %q, %v, want p/c", key, err)
+		}
+	}
+	// a key being deleted is not new either.
+	ks.add("p/c")
+	if _, ok := ks.take(r); !ok {
+		t.Fatal("nothing to take")
+	}
+	if key, err := ks.newKey("p/", r); err == nil {
+		t.Errorf("newKey: %q with all names in use", key)
+	}
+}
+
+func TestKeyTemplateHasPlaceholder(t *testing.T) {
+	kt, err := parseKeyTemplate("{date}/{worker}/obj-{seq}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"date": true, "worker": true, "seq": true, "rand": false, "obj-": false} {
+		if got := kt.hasPlaceholder(name); got != want {
+			t.Errorf("hasPlaceholder(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// BenchmarkObjectName measures the cost of naming an upload of a
+// 1KiB object: with one of the names generated before the test (the
+// default), from a key template, and with -pregenerate-names.
+func BenchmarkObjectName(b *testing.B) {
+	savedNames, savedTemplate, savedPregen := randObjNames, objKeyTemplate, pregenNames
+	defer func() { randObjNames, objKeyTemplate, pregenNames = savedNames, savedTemplate, savedPregen }()
+	randObjNames = []string{newRandomObjectName()}
+	template, err := parseKeyTemplate("{date}/{worker}/{seq}-{rand}")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("generated", func(b *testing.B) {
+		objKeyTemplate = nil
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < b.N; i++ {
+			if _, err := NewRandomObjectWithSize(r, 1024); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("key-template", func(b *testing.B) {
+		objKeyTemplate = template
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < b.N; i++ {
+			if _, err := newNamedObject([]byte(getAlNumPerm(r)), 1024, template.expand("7", r)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pregenerated", func(b *testing.B) {
+		objKeyTemplate = nil
+		names, err := newUniqueNames(b.N)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var used int64
+		r := rand.New(rand.NewSource(1))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := newNamedObject([]byte(getAlNumPerm(r)), 1024, names[atomic.AddInt64(&used, 1)-1]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestKeyHashBudget(t *testing.T) {
+	savedPrefix, savedAttempts, savedBudget := keyHashPrefix, keyHashAttempts, keyHashBudget
+	defer func() {
+		keyHashPrefix, keyHashAttempts, keyHashBudget = savedPrefix, savedAttempts, savedBudget
+		keyHashNames, keyHashMatched, keyHashTries = 0, 0, 0
+		keyHashShards = make(map[string]int64)
+	}()
+	keyHashPrefix, keyHashAttempts, keyHashBudget = "0000", 1000000, 1000
+
+	for i := 0; i < 50; i++ {
+		if _, err := getRandomObjectName(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keyHashTries > keyHashBudget+50 {
+		t.Errorf("%v tries for a budget of %v", keyHashTries, keyHashBudget)
+	}
+	var shardNames int64
+	for prefix, count := range keyHashShards {
+		if len(prefix) != 4 {
+			t.Errorf("shard %q is not a prefix of 4 hex digits", prefix)
+		}
+		shardNames += count
+	}
+	if shardNames != 50 {
+		t.Errorf("%v names in the shards, want 50", shardNames)
+	}
+	msg := getKeyHashMessage()
+	if !strings.Contains(msg, "-hash-budget of 1000 tries was used up") || !strings.Contains(msg, "other hash prefixes of 4 hex digits") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestProgressParts(t *testing.T) {
+	p := &progress{parts: []string{"b1", "b2"}, partDone: make([]int64, 2)}
+	p.addPart(0, 2)
+	p.addPart(1, 1)
+	p.addPart(0, 1)
+	if got, want := p.getPartsMessage(), " [b1: 3, b2: 1]"; got != want {
+		t.Errorf("getPartsMessage() = %q, want %q", got, want)
+	}
+	if p.done != 4 {
+		t.Errorf("done = %v, want 4", p.done)
+	}
+	if got := (&progress{}).getPartsMessage(); got != "" {
+		t.Errorf("getPartsMessage() without parts = %q, want empty", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(200)
+	start := time.Now()
+	for i := 0; i < 41; i++ {
+		tb.wait()
+	}
+	// the first token is available at once, and the next 40 come
+	// at 200 per second.
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond || elapsed > time.Second {
+		t.Errorf("41 operations at 200/s took %v, want about 200ms", elapsed)
+	}
+}
+
+func TestParseRateOps(t *testing.T) {
+	savedWorkload := workload
+	defer func() { workload = savedWorkload }()
+	var err error
+	if workload, err = parseWorkload("get:80,put:20,delete:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := parseRateOps("put, get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || !ops[opPut] || !ops[opGet] {
+		t.Errorf("parsed %v, want put and get", ops)
+	}
+	for _, spec := range []string{"delete", "head", "put,"} {
+		if _, err := parseRateOps(spec); err == nil {
+			t.Errorf("%q: no error", spec)
+		}
+	}
+}
+
+func TestSelectData(t *testing.T) {
+	defer func(saved string) { selectFormat = saved }(selectFormat)
+
+	for _, format := range []string{selectCSV, selectJSON} {
+		selectFormat = format
+		if _, err := newSelectData(0); err == nil {
+			t.Errorf("%v: no error for an empty object", format)
+		}
+		if _, err := newSelectData(minSelectSize() - 1); err == nil {
+			t.Errorf("%v: no error for an object smaller than a record", format)
+		}
+
+		// the whole records that fit in 1000 bytes.
+		var want strings.Builder
+		for i := firstSelectRecord(); want.Len()+len(selectRecord(i)) <= 1000; i++ {
+			want.WriteString(selectRecord(i))
+		}
+		sd, err := newSelectData(1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := sd.Seek(0, io.SeekEnd); n != int64(want.Len()) {
+			t.Errorf("%v: size %v, want %v", format, n, want.Len())
+		}
+		for _, offset := range []int64{0, 7, 500, int64(want.Len())} {
+			if _, err := sd.Seek(offset, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(iotest.OneByteReader(sd))
+			if err != nil {
+				t.Fatal(err)
+			} else if string(got) != want.String()[offset:] {
+				t.Errorf("%v: read %q from %v, want %q", format, got, offset, want.String()[offset:])
+			}
+		}
+
+		sd, err = newSelectData(minSelectSize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(sd); int64(len(got)) != minSelectSize() || !strings.HasSuffix(string(got), selectRecord(0)) {
+			t.Errorf("%v: smallest object %q", format, got)
+		}
+	}
+}
+
+func TestHealthcheckSession(t *testing.T) {
+	defer func(savedEndpoints []s3Endpoint, savedClient *http.Client, savedConns *connTracker) {
+		endpoints, httpClient, conns = savedEndpoints, savedClient, savedConns
+	}(endpoints, httpClient, conns)
+	endpoints = []s3Endpoint{{host: "localhost:9000"}}
+	conns = &connTracker{}
+	httpClient = newHTTPClient()
+	// the SDK only loads a CA bundle into an *http.Transport.
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	workerSess, err := getAWSSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := getHealthcheckSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the connections of the probe are not counted.
+	if _, ok := sess.Config.HTTPClient.Transport.(*http.Transport); !ok || sess.Config.HTTPClient == httpClient {
+		t.Errorf("probe transport %T", sess.Config.HTTPClient.Transport)
+	}
+	if n := aws.IntValue(sess.Config.MaxRetries); n != 0 {
+		t.Errorf("probe retries %v times", n)
+	}
+	// the retries and DNS failures of the probe are not counted.
+	if _, ok := sess.Config.Retryer.(backoffRetryer); ok {
+		t.Error("probe uses the retryer of the workers")
+	}
+	if n, workers := sess.Handlers.Retry.Len(), workerSess.Handlers.Retry.Len(); n >= workers {
+		t.Errorf("probe has %v retry handlers, the workers %v", n, workers)
+	}
+}